@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"auth-api-go/services"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminGetUsers GET /admin/users
+func AdminGetUsers(c *gin.Context) {
+	if _, ok := authorizeAdmin(c); !ok {
+		return
+	}
+
+	filter := services.UserFilter{
+		Query:  c.Query("q"),
+		Role:   c.Query("role"),
+		Status: c.Query("status"),
+	}
+
+	var ok bool
+	if filter.CreatedAfter, ok = parseDateQuery(c, "createdAfter"); !ok {
+		return
+	}
+	if filter.CreatedBefore, ok = parseDateQuery(c, "createdBefore"); !ok {
+		return
+	}
+
+	if value := c.Query("locked"); value != "" {
+		locked, err := strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "locked must be true or false!"})
+			return
+		}
+		filter.Locked = &locked
+	}
+
+	if value := c.Query("deleted"); value != "" {
+		deleted, err := strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "deleted must be true or false!"})
+			return
+		}
+		filter.Deleted = deleted
+	}
+
+	if value := c.Query("cursor"); value != "" {
+		cursor, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor!"})
+			return
+		}
+		filter.Cursor = uint(cursor)
+	}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive number!"})
+			return
+		}
+		filter.Limit = limit
+	}
+
+	users, nextCursor, err := services.ListUsers(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"Users": users, "nextCursor": nextCursor})
+}
+
+// AdminGetUser GET /admin/users/:username
+func AdminGetUser(c *gin.Context) {
+	if _, ok := authorizeAdmin(c); !ok {
+		return
+	}
+
+	user, err := services.GetUserDetail(c.Param("username"))
+	if errors.Is(err, services.ErrUserNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found!"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"User": user})
+}
+
+// AdminRestoreUser POST /admin/users/:username/restore
+func AdminRestoreUser(c *gin.Context) {
+	admin, ok := authorizeAdmin(c)
+	if !ok {
+		return
+	}
+
+	username := c.Param("username")
+
+	_, err := services.RestoreUser(username)
+	if errors.Is(err, services.ErrUserNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No deleted user with that username!"})
+		return
+	}
+	if errors.Is(err, services.ErrRestoreExpired) {
+		c.JSON(http.StatusGone, gin.H{"error": "User was deleted too long ago to restore!"})
+		return
+	}
+	if errors.Is(err, services.ErrUsernameTaken) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Username is in use by another account!"})
+		return
+	}
+	if errors.Is(err, services.ErrRestoreConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Some of the user's memberships or relations have been recreated!"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	recordAudit(services.AuditUserRestore, username, admin, c.ClientIP(), "")
+	c.JSON(http.StatusOK, gin.H{"Restored user": username})
+}
+
+// parseDateQuery reads an optional RFC 3339 time or YYYY-MM-DD date from the
+// query string, writing a 400 if it is neither.
+func parseDateQuery(c *gin.Context, name string) (*time.Time, bool) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, true
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return &parsed, true
+		}
+	}
+
+	c.JSON(http.StatusBadRequest, gin.H{"error": name + " must be a date like 2024-01-31!"})
+	return nil, false
+}
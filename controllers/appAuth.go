@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"auth-api-go/services"
+	"errors"
 	"net/http"
 	"os"
 
@@ -66,3 +67,83 @@ func AppDeleteUser(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"Deleted user": username})
 }
+
+// AppUnlockUser POST /app/user/:username/unlock
+func AppUnlockUser(c *gin.Context) {
+	actor, ok := authorizeApp(c)
+	if !ok {
+		return
+	}
+
+	// Get user from request
+	username := c.Param("username")
+
+	err := services.UnlockAccount(username, actor, c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"Unlocked user": username})
+}
+
+// AppGrantRole POST /app/user/:username/roles
+func AppGrantRole(c *gin.Context) {
+	actor, ok := authorizeApp(c)
+	if !ok {
+		return
+	}
+	grantRole(c, actor)
+}
+
+// AppSuspendUser POST /app/user/:username/suspend
+func AppSuspendUser(c *gin.Context) {
+	actor, ok := authorizeApp(c)
+	if !ok {
+		return
+	}
+	suspendUser(c, actor)
+}
+
+// AppReinstateUser POST /app/user/:username/reinstate
+func AppReinstateUser(c *gin.Context) {
+	actor, ok := authorizeApp(c)
+	if !ok {
+		return
+	}
+	reinstateUser(c, actor)
+}
+
+// AppCreateEmailVerification POST /app/user/:username/email-verification
+func AppCreateEmailVerification(c *gin.Context) {
+	if _, ok := authorizeApp(c); !ok {
+		return
+	}
+
+	username := c.Param("username")
+
+	token, err := services.CreateEmailVerification(username)
+	if errors.Is(err, services.ErrUserNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found!"})
+		return
+	}
+	if errors.Is(err, services.ErrEmailVerificationNotPending) {
+		c.JSON(http.StatusConflict, gin.H{"error": "User is not waiting for email verification!"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"token": token})
+}
+
+// AppRevokeRole DELETE /app/user/:username/roles/:role
+func AppRevokeRole(c *gin.Context) {
+	actor, ok := authorizeApp(c)
+	if !ok {
+		return
+	}
+	revokeRole(c, actor)
+}
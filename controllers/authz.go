@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"auth-api-go/services"
+	"errors"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+)
+
+// Structs
+type authzCheckRequest struct {
+	services.AuthzCheck
+	// Username is who an app is asking about
+	Username string `json:"username"`
+	// Org is the organization an app is asking about
+	Org string `json:"org"`
+}
+
+// checkAuthorization answers every check in the request for username
+func checkAuthorization(c *gin.Context, username string, check services.AuthzCheck) {
+	decisions, err := services.CheckAuthorization(username, check)
+	if errors.Is(err, services.ErrTooManyAuthzChecks) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many checks in one request!"})
+		return
+	}
+	if errors.Is(err, services.ErrNotOrgMember) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not a member of this organization!"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting roles for User!"})
+		return
+	}
+
+	c.JSON(http.StatusOK, decisions)
+}
+
+// AuthzCheck POST /authz/check
+func AuthzCheck(c *gin.Context) {
+	jwtKey := []byte(os.Getenv("JWT_SECRET"))
+	tokenHeader := c.GetHeader("x-auth-token")
+
+	token, err := services.ParseToken(tokenHeader, jwtKey)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid Token!"})
+		return
+	}
+	var username = token.Claims.(jwt.MapClaims)["username"]
+
+	var checkReq authzCheckRequest
+	if err := c.BindJSON(&checkReq); err != nil {
+		return
+	}
+
+	checkReq.AuthzCheck.Org = requestOrg(c)
+	checkAuthorization(c, username.(string), checkReq.AuthzCheck)
+}
+
+// AppAuthzCheck POST /app/authz/check
+func AppAuthzCheck(c *gin.Context) {
+	if _, ok := authorizeApp(c); !ok {
+		return
+	}
+
+	var checkReq authzCheckRequest
+	if err := c.BindJSON(&checkReq); err != nil {
+		return
+	}
+
+	if checkReq.Username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Username is required!"})
+		return
+	}
+
+	checkReq.AuthzCheck.Org = checkReq.Org
+	checkAuthorization(c, checkReq.Username, checkReq.AuthzCheck)
+}
@@ -0,0 +1,30 @@
+package controllers
+
+import (
+	"auth-api-go/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetChallenge GET /challenge
+func GetChallenge(c *gin.Context) {
+	provider, err := services.GetChallengeProvider()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	if provider == nil {
+		c.JSON(http.StatusOK, gin.H{"type": "none"})
+		return
+	}
+
+	challenge, err := provider.Issue(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, challenge)
+}
@@ -0,0 +1,273 @@
+package controllers
+
+import (
+	"auth-api-go/services"
+	"errors"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+)
+
+// Structs
+type groupRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type groupMemberRequest struct {
+	Username string `json:"username"`
+}
+
+type groupRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// GetGroups GET /groups
+func GetGroups(c *gin.Context) {
+	jwtKey := []byte(os.Getenv("JWT_SECRET"))
+	tokenHeader := c.GetHeader("x-auth-token")
+
+	token, err := services.ParseToken(tokenHeader, jwtKey)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid Token!"})
+		return
+	}
+	var username = token.Claims.(jwt.MapClaims)["username"]
+
+	groups, err := services.GetGroupsByUsername(username.(string))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting groups for User!"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"Groups": groups})
+}
+
+// AdminGetGroups GET /admin/groups
+func AdminGetGroups(c *gin.Context) {
+	if _, ok := authorizeAdmin(c); !ok {
+		return
+	}
+
+	groups, err := services.GetGroups()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"Groups": groups})
+}
+
+// AdminCreateGroup POST /admin/groups
+func AdminCreateGroup(c *gin.Context) {
+	admin, ok := authorizeAdmin(c)
+	if !ok {
+		return
+	}
+
+	var groupReq groupRequest
+	if err := c.BindJSON(&groupReq); err != nil {
+		return
+	}
+
+	if groupReq.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Group name is required!"})
+		return
+	}
+
+	group, err := services.CreateGroup(groupReq.Name, groupReq.Description, admin)
+	if errors.Is(err, services.ErrGroupExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Group already exists!"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	recordAudit(services.AuditGroupChange, "", admin, c.ClientIP(), "create "+group.Name)
+
+	c.JSON(http.StatusCreated, gin.H{"Group": group})
+}
+
+// AdminDeleteGroup DELETE /admin/groups/:name
+func AdminDeleteGroup(c *gin.Context) {
+	admin, ok := authorizeAdmin(c)
+	if !ok {
+		return
+	}
+
+	name := c.Param("name")
+
+	err := services.DeleteGroup(name)
+	if errors.Is(err, services.ErrGroupNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found!"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	recordAudit(services.AuditGroupChange, "", admin, c.ClientIP(), "delete "+name)
+
+	c.JSON(http.StatusOK, gin.H{"Deleted group": name})
+}
+
+// AdminGetGroupMembers GET /admin/groups/:name/members
+func AdminGetGroupMembers(c *gin.Context) {
+	if _, ok := authorizeAdmin(c); !ok {
+		return
+	}
+
+	members, err := services.GetGroupMembers(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"Members": members})
+}
+
+// AdminAddGroupMember POST /admin/groups/:name/members
+func AdminAddGroupMember(c *gin.Context) {
+	admin, ok := authorizeAdmin(c)
+	if !ok {
+		return
+	}
+
+	name := c.Param("name")
+
+	var memberReq groupMemberRequest
+	if err := c.BindJSON(&memberReq); err != nil {
+		return
+	}
+
+	_, err := services.GetUserByUsername(memberReq.Username)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found!"})
+		return
+	}
+
+	err = services.AddGroupMember(name, memberReq.Username, admin)
+	if errors.Is(err, services.ErrGroupNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found!"})
+		return
+	}
+	if errors.Is(err, services.ErrGroupMemberExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": "User is already a member of the group!"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	recordAudit(services.AuditGroupJoin, memberReq.Username, admin, c.ClientIP(), name)
+
+	c.JSON(http.StatusCreated, gin.H{"Added Member": memberReq.Username})
+}
+
+// AdminRemoveGroupMember DELETE /admin/groups/:name/members/:username
+func AdminRemoveGroupMember(c *gin.Context) {
+	admin, ok := authorizeAdmin(c)
+	if !ok {
+		return
+	}
+
+	name := c.Param("name")
+	username := c.Param("username")
+
+	err := services.RemoveGroupMember(name, username)
+	if errors.Is(err, services.ErrGroupMemberNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User is not a member of the group!"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	recordAudit(services.AuditGroupLeave, username, admin, c.ClientIP(), name)
+
+	c.JSON(http.StatusOK, gin.H{"Removed Member": username})
+}
+
+// AdminGetGroupRoles GET /admin/groups/:name/roles
+func AdminGetGroupRoles(c *gin.Context) {
+	if _, ok := authorizeAdmin(c); !ok {
+		return
+	}
+
+	roles, err := services.GetGroupRoles(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"Roles": roles})
+}
+
+// AdminAddGroupRole POST /admin/groups/:name/roles
+func AdminAddGroupRole(c *gin.Context) {
+	admin, ok := authorizeAdmin(c)
+	if !ok {
+		return
+	}
+
+	name := c.Param("name")
+
+	var roleReq groupRoleRequest
+	if err := c.BindJSON(&roleReq); err != nil {
+		return
+	}
+
+	err := services.AddGroupRole(name, roleReq.Role)
+	if errors.Is(err, services.ErrGroupNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found!"})
+		return
+	}
+	if errors.Is(err, services.ErrRoleUndefined) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role is not defined!"})
+		return
+	}
+	if errors.Is(err, services.ErrGroupRoleExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Group already has role!"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	recordAudit(services.AuditGroupChange, "", admin, c.ClientIP(), "grant "+roleReq.Role+" to "+name)
+
+	c.JSON(http.StatusCreated, gin.H{"Added Role": roleReq.Role})
+}
+
+// AdminRemoveGroupRole DELETE /admin/groups/:name/roles/:role
+func AdminRemoveGroupRole(c *gin.Context) {
+	admin, ok := authorizeAdmin(c)
+	if !ok {
+		return
+	}
+
+	name := c.Param("name")
+	role := c.Param("role")
+
+	err := services.RemoveGroupRole(name, role)
+	if errors.Is(err, services.ErrGroupRoleNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group does not have role!"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	recordAudit(services.AuditGroupChange, "", admin, c.ClientIP(), "revoke "+role+" from "+name)
+
+	c.JSON(http.StatusOK, gin.H{"Removed Role": role})
+}
@@ -1,6 +1,8 @@
 package controllers
 
 import (
+	"encoding/json"
+	"expvar"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -10,3 +12,11 @@ import (
 func Index(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": ""})
 }
+
+// Metrics GET /metrics
+//
+// Only the password hashing counters are published; the rest of expvar
+// includes the process command line and memory stats.
+func Metrics(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"password_hashing": json.RawMessage(expvar.Get("password_hashing").String())})
+}
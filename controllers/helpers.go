@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"auth-api-go/services"
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+)
+
+// Seconds clients are told to wait when password hashing is saturated
+const hashRetryAfterSeconds = 1
+
+// abortIfHashingBusy writes a 503 when err came from a saturated or cancelled
+// hashing pool and reports whether it did so.
+func abortIfHashingBusy(c *gin.Context, err error) bool {
+	if errors.Is(err, services.ErrHashQueueFull) {
+		c.Header("Retry-After", strconv.Itoa(hashRetryAfterSeconds))
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Server is busy, try again later!"})
+		return true
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Request cancelled!"})
+		return true
+	}
+	return false
+}
+
+// abortIfPolicyViolation writes a 400 listing each broken password rule when
+// err is a *services.PasswordPolicyError and reports whether it did so.
+func abortIfPolicyViolation(c *gin.Context, err error) bool {
+	var policyErr *services.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":      "Password does not meet requirements!",
+		"violations": policyErr.Violations,
+	})
+	return true
+}
+
+// authorizeApp verifies the X-API-Token header, writing a 403 if it is
+// invalid. It returns the calling app's name for audit records.
+func authorizeApp(c *gin.Context) (string, bool) {
+	appJwtKey := []byte(os.Getenv("JWT_APP_SECRET"))
+	tokenHeader := c.GetHeader("X-API-Token")
+
+	token, err := services.ParseToken(tokenHeader, appJwtKey)
+	if err != nil || !token.Valid {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid Token!"})
+		return "", false
+	}
+
+	appName, _ := token.Claims.(jwt.MapClaims)["appName"].(string)
+	if appName == "" {
+		appName, _ = token.Claims.(jwt.MapClaims)["username"].(string)
+	}
+	return "app:" + appName, true
+}
+
+// verifyChallenge checks solution with the configured challenge provider,
+// writing a 400 if it is missing or wrong. It passes when challenges are off.
+func verifyChallenge(c *gin.Context, solution string) bool {
+	provider, err := services.GetChallengeProvider()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return false
+	}
+	if provider == nil {
+		return true
+	}
+
+	err = provider.Verify(c.Request.Context(), solution, c.ClientIP())
+	if errors.Is(err, services.ErrChallengeRequired) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Challenge required!", "challengeRequired": true})
+		return false
+	}
+	if errors.Is(err, services.ErrChallengeFailed) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Challenge failed!", "challengeRequired": true})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return false
+	}
+	return true
+}
+
+// requestOrg returns the organization the Tenant middleware resolved for the
+// request, or "" outside any org.
+func requestOrg(c *gin.Context) string {
+	return c.GetString("org")
+}
+
+// authorizeAdmin verifies the x-auth-token header belongs to a user with the
+// admin role, writing a 403 if not. Only a deployment-wide admin role counts,
+// never one granted in an org. It returns the admin's username.
+func authorizeAdmin(c *gin.Context) (string, bool) {
+	jwtKey := []byte(os.Getenv("JWT_SECRET"))
+	tokenHeader := c.GetHeader("x-auth-token")
+
+	token, err := services.ParseToken(tokenHeader, jwtKey)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid Token!"})
+		return "", false
+	}
+	username := token.Claims.(jwt.MapClaims)["username"].(string)
+
+	isAdmin, err := services.RoleCheck(services.AdminRole, username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting roles for User!"})
+		return "", false
+	}
+	if !isAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admin role required!"})
+		return "", false
+	}
+
+	return username, true
+}
+
+// parseExpiresIn reads an optional duration such as "8h" from a request,
+// writing a 400 if it isn't a positive duration. Empty means no expiry.
+func parseExpiresIn(c *gin.Context, value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, true
+	}
+
+	expiresIn, err := time.ParseDuration(value)
+	if err != nil || expiresIn <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expiresIn must be a positive duration like 8h!"})
+		return 0, false
+	}
+	return expiresIn, true
+}
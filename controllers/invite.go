@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"auth-api-go/services"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Structs
+type inviteRequest struct {
+	MaxUses        int      `json:"maxUses"`
+	ExpiresInHours int      `json:"expiresInHours"`
+	Roles          []string `json:"roles"`
+}
+
+// createInvite writes the new invite, including its code, which is only
+// ever shown in this response.
+func createInvite(c *gin.Context, actor string) {
+	var inviteReq inviteRequest
+	if err := c.BindJSON(&inviteReq); err != nil {
+		return
+	}
+
+	if inviteReq.MaxUses < 0 || inviteReq.ExpiresInHours < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "maxUses and expiresInHours can't be negative!"})
+		return
+	}
+
+	expiresIn := time.Duration(inviteReq.ExpiresInHours) * time.Hour
+	code, invite, err := services.CreateInvite(actor, inviteReq.MaxUses, expiresIn, inviteReq.Roles)
+	if errors.Is(err, services.ErrRoleUndefined) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role is not defined!"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"code": code, "invite": invite})
+}
+
+func listInvites(c *gin.Context) {
+	invites, err := services.GetInvites()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"Invites": invites})
+}
+
+func deleteInvite(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invite id!"})
+		return
+	}
+
+	err = services.DeleteInvite(uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invite not found!"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"Deleted invite": id})
+}
+
+// AppCreateInvite POST /app/invites
+func AppCreateInvite(c *gin.Context) {
+	actor, ok := authorizeApp(c)
+	if !ok {
+		return
+	}
+	createInvite(c, actor)
+}
+
+// AppGetInvites GET /app/invites
+func AppGetInvites(c *gin.Context) {
+	if _, ok := authorizeApp(c); !ok {
+		return
+	}
+	listInvites(c)
+}
+
+// AppDeleteInvite DELETE /app/invites/:id
+func AppDeleteInvite(c *gin.Context) {
+	if _, ok := authorizeApp(c); !ok {
+		return
+	}
+	deleteInvite(c)
+}
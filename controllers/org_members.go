@@ -0,0 +1,254 @@
+package controllers
+
+import (
+	"auth-api-go/services"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+)
+
+// Structs
+type orgRoleRequest struct {
+	Role string `json:"role"`
+}
+
+type orgInvitationRequest struct {
+	Email     string   `json:"email"`
+	Role      string   `json:"role"`
+	Roles     []string `json:"roles"`
+	ExpiresIn string   `json:"expiresIn"`
+}
+
+// authorizeOrgAdmin verifies the x-auth-token header belongs to an admin of
+// the request's org, writing a 403 if not. It returns the caller's username
+// and the org.
+func authorizeOrgAdmin(c *gin.Context) (string, string, bool) {
+	jwtKey := []byte(os.Getenv("JWT_SECRET"))
+	tokenHeader := c.GetHeader("x-auth-token")
+
+	token, err := services.ParseToken(tokenHeader, jwtKey)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid Token!"})
+		return "", "", false
+	}
+	username := token.Claims.(jwt.MapClaims)["username"].(string)
+
+	org := requestOrg(c)
+	if org == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Organization required!"})
+		return "", "", false
+	}
+
+	member, err := services.GetOrgMember(org, username)
+	if errors.Is(err, services.ErrOrgMemberNotFound) || (err == nil && member.Role != services.OrgRoleAdmin) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Organization admin required!"})
+		return "", "", false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return "", "", false
+	}
+
+	return username, org, true
+}
+
+// acceptOrgInvitation accepts the invitation for token on behalf of username
+// while logging in, writing an error if it can't. The invitation has to be
+// for org when the request already resolved one. It returns the org joined.
+func acceptOrgInvitation(c *gin.Context, token string, username string, org string) (string, bool) {
+	invitation, err := services.GetOrgInvitation(token)
+	if err == nil && org != "" && invitation.Org != org {
+		err = services.ErrOrgInvitationInvalid
+	}
+	if err == nil {
+		_, err = services.AcceptOrgInvitation(token, username)
+	}
+	if errors.Is(err, services.ErrOrgInvitationInvalid) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid organization invitation!"})
+		return "", false
+	}
+	if errors.Is(err, services.ErrOrgInvitationEmail) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invitation is for another email address!"})
+		return "", false
+	}
+	if errors.Is(err, services.ErrOrgMemberExists) {
+		// Already in, nothing to accept
+		return invitation.Org, true
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return "", false
+	}
+
+	recordAudit(services.AuditOrgJoin, username, username, c.ClientIP(), invitation.Org)
+	return invitation.Org, true
+}
+
+// GetOrgMembers GET /org/members
+func GetOrgMembers(c *gin.Context) {
+	_, org, ok := authorizeOrgAdmin(c)
+	if !ok {
+		return
+	}
+
+	members, err := services.GetOrgMembers(org)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"Members": members})
+}
+
+// ChangeOrgMemberRole PUT /org/members/:username
+func ChangeOrgMemberRole(c *gin.Context) {
+	orgAdmin, org, ok := authorizeOrgAdmin(c)
+	if !ok {
+		return
+	}
+
+	var roleReq orgRoleRequest
+	if err := c.BindJSON(&roleReq); err != nil {
+		return
+	}
+
+	username := c.Param("username")
+
+	err := services.ChangeOrgMemberRole(org, username, roleReq.Role)
+	if abortIfOrgMemberError(c, err) {
+		return
+	}
+
+	recordAudit(services.AuditOrgRoleChange, username, orgAdmin, c.ClientIP(), org+" "+roleReq.Role)
+	c.JSON(http.StatusOK, gin.H{"Member": username, "role": roleReq.Role})
+}
+
+// RemoveOrgMember DELETE /org/members/:username
+func RemoveOrgMember(c *gin.Context) {
+	orgAdmin, org, ok := authorizeOrgAdmin(c)
+	if !ok {
+		return
+	}
+
+	username := c.Param("username")
+
+	err := services.RemoveOrgMember(org, username)
+	if abortIfOrgMemberError(c, err) {
+		return
+	}
+
+	recordAudit(services.AuditOrgLeave, username, orgAdmin, c.ClientIP(), org)
+	c.JSON(http.StatusOK, gin.H{"Removed Member": username})
+}
+
+// GetOrgInvitations GET /org/invitations
+func GetOrgInvitations(c *gin.Context) {
+	_, org, ok := authorizeOrgAdmin(c)
+	if !ok {
+		return
+	}
+
+	invitations, err := services.GetOrgInvitations(org)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"Invitations": invitations})
+}
+
+// CreateOrgInvitation POST /org/invitations
+func CreateOrgInvitation(c *gin.Context) {
+	orgAdmin, org, ok := authorizeOrgAdmin(c)
+	if !ok {
+		return
+	}
+
+	var invitationReq orgInvitationRequest
+	if err := c.BindJSON(&invitationReq); err != nil {
+		return
+	}
+
+	expiresIn, ok := parseExpiresIn(c, invitationReq.ExpiresIn)
+	if !ok {
+		return
+	}
+
+	token, invitation, err := services.CreateOrgInvitation(org, invitationReq.Email, invitationReq.Role, invitationReq.Roles, orgAdmin, expiresIn)
+	if errors.Is(err, services.ErrOrgInvitationEmailless) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Email is required!"})
+		return
+	}
+	if errors.Is(err, services.ErrOrgRoleInvalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role must be admin or member!"})
+		return
+	}
+	if errors.Is(err, services.ErrRoleUndefined) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role is not defined!"})
+		return
+	}
+	if errors.Is(err, services.ErrOrgInvitationRole) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only assignable roles can be granted through an invitation!"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	detail := invitation.Email + " " + org + " " + invitation.Role
+	if invitation.Roles != "" {
+		detail += " " + invitation.Roles
+	}
+	recordAudit(services.AuditOrgInvite, "", orgAdmin, c.ClientIP(), detail)
+	c.JSON(http.StatusCreated, gin.H{"token": token, "Invitation": invitation})
+}
+
+// RevokeOrgInvitation DELETE /org/invitations/:id
+func RevokeOrgInvitation(c *gin.Context) {
+	orgAdmin, org, ok := authorizeOrgAdmin(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invitation id!"})
+		return
+	}
+
+	err = services.RevokeOrgInvitation(org, uint(id))
+	if errors.Is(err, services.ErrOrgInvitationNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found!"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	recordAudit(services.AuditOrgInviteRevoke, "", orgAdmin, c.ClientIP(), org+" "+c.Param("id"))
+	c.JSON(http.StatusOK, gin.H{"Revoked Invitation": id})
+}
+
+// abortIfOrgMemberError writes the response for an error changing an org's
+// members and reports whether it did so.
+func abortIfOrgMemberError(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, services.ErrOrgRoleInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role must be admin or member!"})
+	case errors.Is(err, services.ErrLastOrgAdmin):
+		c.JSON(http.StatusConflict, gin.H{"error": "Organization needs at least one admin!"})
+	case errors.Is(err, services.ErrOrgMemberNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User is not a member of the organization!"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+	}
+	return true
+}
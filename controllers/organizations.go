@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"auth-api-go/services"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Structs
+type organizationRequest struct {
+	Slug   string `json:"slug"`
+	Name   string `json:"name"`
+	Domain string `json:"domain"`
+}
+
+type orgMemberRequest struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+// AdminGetOrganizations GET /admin/orgs
+func AdminGetOrganizations(c *gin.Context) {
+	if _, ok := authorizeAdmin(c); !ok {
+		return
+	}
+
+	orgs, err := services.GetOrganizations()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"Organizations": orgs})
+}
+
+// AdminCreateOrganization POST /admin/orgs
+func AdminCreateOrganization(c *gin.Context) {
+	admin, ok := authorizeAdmin(c)
+	if !ok {
+		return
+	}
+
+	var orgReq organizationRequest
+	if err := c.BindJSON(&orgReq); err != nil {
+		return
+	}
+
+	org, err := services.CreateOrganization(orgReq.Slug, orgReq.Name, orgReq.Domain, admin)
+	if errors.Is(err, services.ErrOrgInvalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Slugs may only use lower case letters, digits and hyphens!"})
+		return
+	}
+	if errors.Is(err, services.ErrOrgExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Organization already exists!"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"Organization": org})
+}
+
+// AdminGetOrgMembers GET /admin/orgs/:slug/members
+func AdminGetOrgMembers(c *gin.Context) {
+	if _, ok := authorizeAdmin(c); !ok {
+		return
+	}
+
+	members, err := services.GetOrgMembers(c.Param("slug"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"Members": members})
+}
+
+// AdminAddOrgMember POST /admin/orgs/:slug/members
+func AdminAddOrgMember(c *gin.Context) {
+	admin, ok := authorizeAdmin(c)
+	if !ok {
+		return
+	}
+
+	var memberReq orgMemberRequest
+	if err := c.BindJSON(&memberReq); err != nil {
+		return
+	}
+
+	_, err := services.GetUserByUsername(memberReq.Username)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found!"})
+		return
+	}
+
+	err = services.AddOrgMember(c.Param("slug"), memberReq.Username, memberReq.Role, admin)
+	if errors.Is(err, services.ErrOrgRoleInvalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role must be admin or member!"})
+		return
+	}
+	if errors.Is(err, services.ErrOrgNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found!"})
+		return
+	}
+	if errors.Is(err, services.ErrOrgMemberExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": "User is already a member of the organization!"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	recordAudit(services.AuditOrgJoin, memberReq.Username, admin, c.ClientIP(), c.Param("slug"))
+	c.JSON(http.StatusCreated, gin.H{"Added Member": memberReq.Username})
+}
+
+// AdminRemoveOrgMember DELETE /admin/orgs/:slug/members/:username
+func AdminRemoveOrgMember(c *gin.Context) {
+	admin, ok := authorizeAdmin(c)
+	if !ok {
+		return
+	}
+
+	username := c.Param("username")
+
+	err := services.RemoveOrgMember(c.Param("slug"), username)
+	if abortIfOrgMemberError(c, err) {
+		return
+	}
+
+	recordAudit(services.AuditOrgLeave, username, admin, c.ClientIP(), c.Param("slug"))
+
+	c.JSON(http.StatusOK, gin.H{"Removed Member": username})
+}
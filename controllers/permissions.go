@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"auth-api-go/services"
+	"errors"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+)
+
+// Structs
+type permissionRequest struct {
+	Permission string `json:"permission"`
+}
+
+// GetPermissions GET /permissions
+func GetPermissions(c *gin.Context) {
+	jwtKey := []byte(os.Getenv("JWT_SECRET"))
+	tokenHeader := c.GetHeader("x-auth-token")
+
+	token, err := services.ParseToken(tokenHeader, jwtKey)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid Token!"})
+		return
+	}
+	var username = token.Claims.(jwt.MapClaims)["username"]
+
+	permissions, err := services.GetOrgPermissionsByUsername(username.(string), requestOrg(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting permissions for User!"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"Permissions": permissions})
+}
+
+// HasPermission GET /permissions/<permission>
+func HasPermission(c *gin.Context) {
+	jwtKey := []byte(os.Getenv("JWT_SECRET"))
+	tokenHeader := c.GetHeader("x-auth-token")
+
+	permission := c.Param("permission")
+
+	token, err := services.ParseToken(tokenHeader, jwtKey)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid Token!"})
+		return
+	}
+	var username = token.Claims.(jwt.MapClaims)["username"]
+
+	hasPermission, err := services.HasOrgPermission(username.(string), requestOrg(c), permission)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting permissions for User!"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"hasPermission": hasPermission})
+}
+
+// AdminGetRolePermissions GET /admin/roles/:name/permissions
+func AdminGetRolePermissions(c *gin.Context) {
+	if _, ok := authorizeAdmin(c); !ok {
+		return
+	}
+
+	permissions, err := services.GetRolePermissions(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"Permissions": permissions})
+}
+
+// AdminAddRolePermission POST /admin/roles/:name/permissions
+func AdminAddRolePermission(c *gin.Context) {
+	admin, ok := authorizeAdmin(c)
+	if !ok {
+		return
+	}
+
+	role := c.Param("name")
+
+	var permissionReq permissionRequest
+	if err := c.BindJSON(&permissionReq); err != nil {
+		return
+	}
+
+	err := services.AddRolePermission(role, permissionReq.Permission)
+	if errors.Is(err, services.ErrPermissionInvalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Permission must look like resource:action!"})
+		return
+	}
+	if errors.Is(err, services.ErrRoleUndefined) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role is not defined!"})
+		return
+	}
+	if errors.Is(err, services.ErrPermissionExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Role already has permission!"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	recordAudit(services.AuditPermissionGrant, "", admin, c.ClientIP(), role+" "+permissionReq.Permission)
+
+	c.JSON(http.StatusCreated, gin.H{"Added Permission": permissionReq.Permission})
+}
+
+// AdminRemoveRolePermission DELETE /admin/roles/:name/permissions/:permission
+func AdminRemoveRolePermission(c *gin.Context) {
+	admin, ok := authorizeAdmin(c)
+	if !ok {
+		return
+	}
+
+	role := c.Param("name")
+	permission := c.Param("permission")
+
+	err := services.RemoveRolePermission(role, permission)
+	if errors.Is(err, services.ErrPermissionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role does not have permission!"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	recordAudit(services.AuditPermissionRevoke, "", admin, c.ClientIP(), role+" "+permission)
+
+	c.JSON(http.StatusOK, gin.H{"Removed Permission": permission})
+}
@@ -0,0 +1,233 @@
+package controllers
+
+import (
+	"auth-api-go/models"
+	"auth-api-go/services"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+	"gorm.io/gorm"
+)
+
+// Structs
+type policyRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Action      string `json:"action"`
+	Effect      string `json:"effect"`
+	Expression  string `json:"expression"`
+	Enabled     *bool  `json:"enabled"`
+}
+
+type decideRequest struct {
+	services.PolicyRequest
+	// Username is who an app is asking about
+	Username string `json:"username"`
+	// Org is the organization an app is asking about
+	Org string `json:"org"`
+}
+
+// abortIfPolicyInvalid writes a 400 explaining why a policy was rejected
+func abortIfPolicyInvalid(c *gin.Context, err error) bool {
+	var invalidErr *services.PolicyInvalidError
+	if !errors.As(err, &invalidErr) {
+		return false
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid policy!", "reason": invalidErr.Reason})
+	return true
+}
+
+func parsePolicyID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid policy id!"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// AdminGetPolicies GET /admin/policies
+func AdminGetPolicies(c *gin.Context) {
+	if _, ok := authorizeAdmin(c); !ok {
+		return
+	}
+
+	policies, err := services.GetPolicies()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"Policies": policies})
+}
+
+// AdminCreatePolicy POST /admin/policies
+func AdminCreatePolicy(c *gin.Context) {
+	admin, ok := authorizeAdmin(c)
+	if !ok {
+		return
+	}
+
+	var policyReq policyRequest
+	if err := c.BindJSON(&policyReq); err != nil {
+		return
+	}
+
+	policy := &models.Policy{
+		Name:        policyReq.Name,
+		Description: policyReq.Description,
+		Action:      policyReq.Action,
+		Effect:      policyReq.Effect,
+		Expression:  policyReq.Expression,
+		Enabled:     policyReq.Enabled == nil || *policyReq.Enabled,
+		CreatedBy:   admin,
+	}
+
+	err := services.CreatePolicy(policy)
+	if abortIfPolicyInvalid(c, err) {
+		return
+	}
+	if errors.Is(err, services.ErrPolicyExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Policy name is already taken!"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	recordAudit(services.AuditPolicyChange, "", admin, c.ClientIP(), "create "+policy.Name)
+
+	c.JSON(http.StatusCreated, gin.H{"Policy": policy})
+}
+
+// AdminUpdatePolicy PUT /admin/policies/:id
+func AdminUpdatePolicy(c *gin.Context) {
+	admin, ok := authorizeAdmin(c)
+	if !ok {
+		return
+	}
+
+	id, ok := parsePolicyID(c)
+	if !ok {
+		return
+	}
+
+	var update services.PolicyUpdate
+	if err := c.BindJSON(&update); err != nil {
+		return
+	}
+
+	policy, err := services.UpdatePolicy(id, update)
+	if abortIfPolicyInvalid(c, err) {
+		return
+	}
+	if errors.Is(err, services.ErrPolicyNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Policy not found!"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	recordAudit(services.AuditPolicyChange, "", admin, c.ClientIP(), "update "+policy.Name)
+
+	c.JSON(http.StatusOK, gin.H{"Policy": policy})
+}
+
+// AdminDeletePolicy DELETE /admin/policies/:id
+func AdminDeletePolicy(c *gin.Context) {
+	admin, ok := authorizeAdmin(c)
+	if !ok {
+		return
+	}
+
+	id, ok := parsePolicyID(c)
+	if !ok {
+		return
+	}
+
+	err := services.DeletePolicy(id)
+	if errors.Is(err, services.ErrPolicyNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Policy not found!"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	recordAudit(services.AuditPolicyChange, "", admin, c.ClientIP(), "delete "+c.Param("id"))
+
+	c.JSON(http.StatusOK, gin.H{"Deleted policy": id})
+}
+
+// decidePolicy evaluates the policies for username and writes the decision
+func decidePolicy(c *gin.Context, username string, req services.PolicyRequest) {
+	req.IP = c.ClientIP()
+
+	decision, err := services.DecidePolicy(username, req)
+	if abortIfPolicyInvalid(c, err) {
+		return
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found!"})
+		return
+	}
+	if errors.Is(err, services.ErrNotOrgMember) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not a member of this organization!"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error evaluating policies!"})
+		return
+	}
+
+	c.JSON(http.StatusOK, decision)
+}
+
+// AuthzDecide POST /authz/decide
+func AuthzDecide(c *gin.Context) {
+	jwtKey := []byte(os.Getenv("JWT_SECRET"))
+	tokenHeader := c.GetHeader("x-auth-token")
+
+	token, err := services.ParseToken(tokenHeader, jwtKey)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid Token!"})
+		return
+	}
+	var username = token.Claims.(jwt.MapClaims)["username"]
+
+	var decideReq decideRequest
+	if err := c.BindJSON(&decideReq); err != nil {
+		return
+	}
+
+	decideReq.PolicyRequest.Org = requestOrg(c)
+	decidePolicy(c, username.(string), decideReq.PolicyRequest)
+}
+
+// AppAuthzDecide POST /app/authz/decide
+func AppAuthzDecide(c *gin.Context) {
+	if _, ok := authorizeApp(c); !ok {
+		return
+	}
+
+	var decideReq decideRequest
+	if err := c.BindJSON(&decideReq); err != nil {
+		return
+	}
+
+	if decideReq.Username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Username is required!"})
+		return
+	}
+
+	decideReq.PolicyRequest.Org = decideReq.Org
+	decidePolicy(c, decideReq.Username, decideReq.PolicyRequest)
+}
@@ -0,0 +1,264 @@
+package controllers
+
+import (
+	"auth-api-go/services"
+	"errors"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+)
+
+// Structs
+type tupleRequest struct {
+	Object   string `json:"object"`
+	Relation string `json:"relation"`
+	// Subject is a username or a userset like "group:eng#member"
+	Subject string `json:"subject"`
+}
+
+type relationCheckRequest struct {
+	Object   string `json:"object"`
+	Relation string `json:"relation"`
+	// Username is who an app is asking about
+	Username string `json:"username"`
+}
+
+type listObjectsRequest struct {
+	Namespace string `json:"namespace"`
+	Relation  string `json:"relation"`
+	Username  string `json:"username"`
+}
+
+// abortIfRelationInvalid writes a 400 or 404 for a bad object or relation
+func abortIfRelationInvalid(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, services.ErrObjectInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Objects must look like namespace:id!"})
+	case errors.Is(err, services.ErrNamespaceNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Namespace not found!"})
+	case errors.Is(err, services.ErrRelationUndefined):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Relation is not defined for the namespace!"})
+	case errors.Is(err, services.ErrRelationTooDeep):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Relation is nested too deeply!"})
+	default:
+		return false
+	}
+	return true
+}
+
+// AdminGetNamespaces GET /admin/namespaces
+func AdminGetNamespaces(c *gin.Context) {
+	if _, ok := authorizeAdmin(c); !ok {
+		return
+	}
+
+	namespaces, err := services.GetNamespaces()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"Namespaces": namespaces})
+}
+
+// AdminSaveNamespace PUT /admin/namespaces/:name
+func AdminSaveNamespace(c *gin.Context) {
+	if _, ok := authorizeAdmin(c); !ok {
+		return
+	}
+
+	var config services.NamespaceConfig
+	if err := c.BindJSON(&config); err != nil {
+		return
+	}
+
+	name := c.Param("name")
+	err := services.SaveNamespace(name, config)
+	if errors.Is(err, services.ErrNamespaceInvalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid namespace!", "reason": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"Namespace": name, "Config": config})
+}
+
+// AppWriteTuple POST /app/relations
+func AppWriteTuple(c *gin.Context) {
+	if _, ok := authorizeApp(c); !ok {
+		return
+	}
+
+	var tupleReq tupleRequest
+	if err := c.BindJSON(&tupleReq); err != nil {
+		return
+	}
+
+	err := services.WriteTuple(tupleReq.Object, tupleReq.Relation, tupleReq.Subject)
+	if abortIfRelationInvalid(c, err) {
+		return
+	}
+	if errors.Is(err, services.ErrRelationTupleExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Relation already exists!"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"Tuple": tupleReq})
+}
+
+// AppDeleteTuple DELETE /app/relations
+func AppDeleteTuple(c *gin.Context) {
+	if _, ok := authorizeApp(c); !ok {
+		return
+	}
+
+	var tupleReq tupleRequest
+	if err := c.BindJSON(&tupleReq); err != nil {
+		return
+	}
+
+	err := services.DeleteTuple(tupleReq.Object, tupleReq.Relation, tupleReq.Subject)
+	if errors.Is(err, services.ErrRelationTupleAbsent) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Relation not found!"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"Deleted tuple": tupleReq})
+}
+
+// checkRelation checks username's relation to object and writes the result
+func checkRelation(c *gin.Context, object string, relation string, username string) {
+	allowed, err := services.CheckRelation(object, relation, username)
+	if abortIfRelationInvalid(c, err) {
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking relation!"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"object": object, "relation": relation, "username": username, "allowed": allowed})
+}
+
+// listObjects writes the objects username has relation to
+func listObjects(c *gin.Context, namespace string, relation string, username string) {
+	objects, truncated, err := services.ListObjects(namespace, relation, username)
+	if abortIfRelationInvalid(c, err) {
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing objects!"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"objects": objects, "truncated": truncated})
+}
+
+// RelationCheck POST /relations/check
+func RelationCheck(c *gin.Context) {
+	jwtKey := []byte(os.Getenv("JWT_SECRET"))
+	tokenHeader := c.GetHeader("x-auth-token")
+
+	token, err := services.ParseToken(tokenHeader, jwtKey)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid Token!"})
+		return
+	}
+	var username = token.Claims.(jwt.MapClaims)["username"]
+
+	var checkReq relationCheckRequest
+	if err := c.BindJSON(&checkReq); err != nil {
+		return
+	}
+
+	checkRelation(c, checkReq.Object, checkReq.Relation, username.(string))
+}
+
+// RelationObjects GET /relations/objects?namespace=&relation=
+func RelationObjects(c *gin.Context) {
+	jwtKey := []byte(os.Getenv("JWT_SECRET"))
+	tokenHeader := c.GetHeader("x-auth-token")
+
+	token, err := services.ParseToken(tokenHeader, jwtKey)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid Token!"})
+		return
+	}
+	var username = token.Claims.(jwt.MapClaims)["username"]
+
+	listObjects(c, c.Query("namespace"), c.Query("relation"), username.(string))
+}
+
+// AppRelationCheck POST /app/relations/check
+func AppRelationCheck(c *gin.Context) {
+	if _, ok := authorizeApp(c); !ok {
+		return
+	}
+
+	var checkReq relationCheckRequest
+	if err := c.BindJSON(&checkReq); err != nil {
+		return
+	}
+
+	if checkReq.Username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Username is required!"})
+		return
+	}
+
+	checkRelation(c, checkReq.Object, checkReq.Relation, checkReq.Username)
+}
+
+// AppRelationExpand POST /app/relations/expand
+func AppRelationExpand(c *gin.Context) {
+	if _, ok := authorizeApp(c); !ok {
+		return
+	}
+
+	var expandReq relationCheckRequest
+	if err := c.BindJSON(&expandReq); err != nil {
+		return
+	}
+
+	tree, err := services.ExpandRelation(expandReq.Object, expandReq.Relation)
+	if abortIfRelationInvalid(c, err) {
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error expanding relation!"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tree)
+}
+
+// AppRelationObjects POST /app/relations/objects
+func AppRelationObjects(c *gin.Context) {
+	if _, ok := authorizeApp(c); !ok {
+		return
+	}
+
+	var listReq listObjectsRequest
+	if err := c.BindJSON(&listReq); err != nil {
+		return
+	}
+
+	if listReq.Username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Username is required!"})
+		return
+	}
+
+	listObjects(c, listReq.Namespace, listReq.Relation, listReq.Username)
+}
@@ -0,0 +1,207 @@
+package controllers
+
+import (
+	"auth-api-go/services"
+	"errors"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Structs
+type roleDefinitionRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Assignable  bool   `json:"assignable"`
+}
+
+type roleParentRequest struct {
+	Parent string `json:"parent"`
+}
+
+type roleDefinitionUpdate struct {
+	Description *string `json:"description"`
+	Assignable  *bool   `json:"assignable"`
+}
+
+// GetRoleCatalog GET /roles/catalog
+func GetRoleCatalog(c *gin.Context) {
+	jwtKey := []byte(os.Getenv("JWT_SECRET"))
+	tokenHeader := c.GetHeader("x-auth-token")
+
+	_, err := services.ParseToken(tokenHeader, jwtKey)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid Token!"})
+		return
+	}
+
+	definitions, err := services.GetRoleDefinitions()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting role catalog!"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"Roles": definitions})
+}
+
+// AdminCreateRole POST /admin/roles
+func AdminCreateRole(c *gin.Context) {
+	admin, ok := authorizeAdmin(c)
+	if !ok {
+		return
+	}
+
+	var roleReq roleDefinitionRequest
+	if err := c.BindJSON(&roleReq); err != nil {
+		return
+	}
+
+	if roleReq.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role name is required!"})
+		return
+	}
+
+	definition, err := services.CreateRoleDefinition(roleReq.Name, roleReq.Description, admin, roleReq.Assignable)
+	if errors.Is(err, services.ErrRoleExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Role is already defined!"})
+		return
+	}
+	if errors.Is(err, services.ErrRoleBuiltIn) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Built-in roles can't be changed!"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"Role": definition})
+}
+
+// AdminUpdateRole PUT /admin/roles/:name
+func AdminUpdateRole(c *gin.Context) {
+	if _, ok := authorizeAdmin(c); !ok {
+		return
+	}
+
+	var roleReq roleDefinitionUpdate
+	if err := c.BindJSON(&roleReq); err != nil {
+		return
+	}
+
+	definition, err := services.UpdateRoleDefinition(c.Param("name"), roleReq.Description, roleReq.Assignable)
+	if errors.Is(err, services.ErrRoleUndefined) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role is not defined!"})
+		return
+	}
+	if errors.Is(err, services.ErrRoleBuiltIn) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Built-in roles can't be changed!"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"Role": definition})
+}
+
+// AdminDeleteRole DELETE /admin/roles/:name
+func AdminDeleteRole(c *gin.Context) {
+	if _, ok := authorizeAdmin(c); !ok {
+		return
+	}
+
+	name := c.Param("name")
+
+	err := services.DeleteRoleDefinition(name)
+	if errors.Is(err, services.ErrRoleUndefined) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role is not defined!"})
+		return
+	}
+	if errors.Is(err, services.ErrRoleBuiltIn) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Built-in roles can't be changed!"})
+		return
+	}
+	if errors.Is(err, services.ErrRoleInUse) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Role is still granted to users!"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"Deleted Role": name})
+}
+
+// AdminGetRoleParents GET /admin/roles/:name/parents
+func AdminGetRoleParents(c *gin.Context) {
+	if _, ok := authorizeAdmin(c); !ok {
+		return
+	}
+
+	parents, err := services.GetRoleParents(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"Parents": parents})
+}
+
+// AdminAddRoleParent POST /admin/roles/:name/parents
+func AdminAddRoleParent(c *gin.Context) {
+	if _, ok := authorizeAdmin(c); !ok {
+		return
+	}
+
+	role := c.Param("name")
+
+	var parentReq roleParentRequest
+	if err := c.BindJSON(&parentReq); err != nil {
+		return
+	}
+
+	err := services.AddRoleParent(role, parentReq.Parent)
+	if errors.Is(err, services.ErrRoleUndefined) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role is not defined!"})
+		return
+	}
+	if errors.Is(err, services.ErrRoleInheritanceCycle) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role inheritance would form a cycle!"})
+		return
+	}
+	if errors.Is(err, services.ErrRoleInheritanceExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Role already inherits from parent!"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"Added Parent": parentReq.Parent})
+}
+
+// AdminRemoveRoleParent DELETE /admin/roles/:name/parents/:parent
+func AdminRemoveRoleParent(c *gin.Context) {
+	if _, ok := authorizeAdmin(c); !ok {
+		return
+	}
+
+	parent := c.Param("parent")
+
+	err := services.RemoveRoleParent(c.Param("name"), parent)
+	if errors.Is(err, services.ErrRoleInheritanceNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role does not inherit from parent!"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"Removed Parent": parent})
+}
@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"auth-api-go/services"
+	"errors"
 	"net/http"
 	"os"
 
@@ -12,6 +13,12 @@ import (
 // Structs
 type roleRequest struct {
 	Role string `json:"role"`
+	// ExpiresIn is an optional Go duration such as "8h" for temporary grants
+	ExpiresIn string `json:"expiresIn"`
+	// Username lets admins grant the role to someone else
+	Username string `json:"username"`
+	// Org lets admins and apps grant the role in one organization only
+	Org string `json:"org"`
 }
 
 // GetRoles GET /roles
@@ -26,7 +33,7 @@ func GetRoles(c *gin.Context) {
 	}
 	var username = token.Claims.(jwt.MapClaims)["username"]
 
-	roles, err := services.GetRolesByUsername(username.(string))
+	roles, err := services.GetOrgRolesByUsername(username.(string), requestOrg(c))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Roles for User not found!"})
 		return
@@ -51,14 +58,24 @@ func DoesUserHaveRole(c *gin.Context) {
 	}
 	var username = token.Claims.(jwt.MapClaims)["username"]
 
-	// Look to see if user already has role
-	hasRoleAlready, err := services.RoleCheck(role, username.(string))
+	// Look to see if user already has role, directly or inherited
+	grant, err := services.GetOrgRoleGrant(role, username.(string), requestOrg(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting roles for User!"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"hasRoleAlready": hasRoleAlready})
+	if grant == nil {
+		c.JSON(http.StatusOK, gin.H{"hasRoleAlready": false})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"hasRoleAlready": true,
+		"inherited":      grant.InheritedFrom != "",
+		"inheritedFrom":  grant.InheritedFrom,
+		"group":          grant.Group,
+	})
 }
 
 // AddRole POST /roles
@@ -79,24 +96,120 @@ func AddRole(c *gin.Context) {
 		return
 	}
 
-	// Look to see if user already has role
-	hasRoleAlready, err := services.RoleCheck(newRole.Role, username.(string))
+	// Granting to someone else needs the admin role
+	if newRole.Username != "" && newRole.Username != username.(string) {
+		admin, ok := authorizeAdmin(c)
+		if !ok {
+			return
+		}
+		newRole.Org = requestOrg(c)
+		grantRoleTo(c, admin, newRole.Username, newRole)
+		return
+	}
+
+	expiresIn, ok := parseExpiresIn(c, newRole.ExpiresIn)
+	if !ok {
+		return
+	}
+
+	// Look to see if user already has role. An inherited or group role can
+	// still be granted directly so it outlives the role or group it came through.
+	grant, err := services.GetOrgRoleGrant(newRole.Role, username.(string), requestOrg(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting roles for User!"})
 		return
 	}
 
-	if hasRoleAlready {
+	if grant != nil && grant.InheritedFrom == "" && grant.Group == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "User already has role!"})
 		return
 	}
 
 	// Add Role
-	err = services.AddRole(username.(string), newRole.Role)
+	err = services.AssignOwnRole(username.(string), requestOrg(c), newRole.Role, expiresIn)
+	if errors.Is(err, services.ErrRoleNotSelfAssignable) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Role can't be self-assigned!"})
+		return
+	}
+	if errors.Is(err, services.ErrRoleUndefined) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role is not defined!"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	// The old session ends when tokens embed roles; hand out its replacement
+	newToken, err := services.CreateOrgToken(username.(string), requestOrg(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"Added Role": newRole.Role, "token": newToken})
+}
+
+// RemoveRole DELETE /roles/<role>
+func RemoveRole(c *gin.Context) {
+	jwtKey := []byte(os.Getenv("JWT_SECRET"))
+	tokenHeader := c.GetHeader("x-auth-token")
+
+	// Get role from url
+	role := c.Param("role")
+
+	// Get user from token
+	token, err := services.ParseToken(tokenHeader, jwtKey)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid Token!"})
+		return
+	}
+	var username = token.Claims.(jwt.MapClaims)["username"]
+
+	grant, err := services.GetOrgRoleGrant(role, username.(string), requestOrg(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting roles for User!"})
+		return
+	}
+
+	if grant == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User does not have role!"})
+		return
+	}
+
+	if grant.InheritedFrom != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role is inherited from " + grant.InheritedFrom + "!"})
+		return
+	}
+
+	if grant.Group != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role is held through group " + grant.Group + "!"})
+		return
+	}
+
+	// Inside an org only the org's own grant can go, never the deployment-wide one
+	if grant.Org != requestOrg(c) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role is granted outside this organization!"})
+		return
+	}
+
+	// Remove Role
+	err = services.RemoveOwnRole(username.(string), grant.Org, role)
+	if errors.Is(err, services.ErrRoleNotSelfAssignable) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Role can't be self-removed!"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	// The old session ends when tokens embed roles; hand out its replacement
+	newToken, err := services.CreateOrgToken(username.(string), requestOrg(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"Added Role": newRole.Role})
+	c.JSON(http.StatusOK, gin.H{"Removed Role": role, "token": newToken})
 }
@@ -2,17 +2,34 @@ package controllers
 
 import (
 	"auth-api-go/services"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
 	"os"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt"
 )
 
+// Same message for unknown usernames and wrong passwords
+const invalidCredentialsMessage = "Invalid username or password!"
+
 // Structs
 type userRequest struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	Challenge  string `json:"challenge"`
+	Email      string `json:"email"`
+	InviteCode string `json:"inviteCode"`
+	// Organization invitation token to accept
+	OrgInvitation string `json:"orgInvitation"`
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
 }
 
 // Register POST /register
@@ -23,13 +40,93 @@ func Register(c *gin.Context) {
 		return
 	}
 
-	userEntry, err := services.CreateUser(newUser.Username, newUser.Password)
+	if !verifyChallenge(c, newUser.Challenge) {
+		return
+	}
+
+	// With duplicates concealed, a taken username gets the same answer as a
+	// new registration and the client has to log in to get a token
+	concealDuplicates := os.Getenv("REGISTRATION_CONCEAL_DUPLICATES") == "true"
+
+	// Signing up from an org invitation lands the new session in that org
+	var org string
+	if newUser.OrgInvitation != "" {
+		invitation, err := services.GetOrgInvitation(newUser.OrgInvitation)
+		if errors.Is(err, services.ErrOrgInvitationInvalid) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Invalid organization invitation!"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+			return
+		}
+		org = invitation.Org
+	}
+
+	userEntry, err := services.RegisterUser(c.Request.Context(), services.Registration{
+		Username:      newUser.Username,
+		Password:      newUser.Password,
+		Email:         newUser.Email,
+		InviteCode:    newUser.InviteCode,
+		OrgInvitation: newUser.OrgInvitation,
+	})
+	if abortIfHashingBusy(c, err) || abortIfPolicyViolation(c, err) {
+		return
+	}
+	if errors.Is(err, services.ErrOrgInvitationInvalid) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid organization invitation!"})
+		return
+	}
+	if errors.Is(err, services.ErrOrgInvitationEmail) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invitation is for another email address!"})
+		return
+	}
+	if errors.Is(err, services.ErrRegistrationDisabled) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Registration is closed!"})
+		return
+	}
+	if errors.Is(err, services.ErrInviteRequired) || errors.Is(err, services.ErrInviteInvalid) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid invite code!"})
+		return
+	}
+	if errors.Is(err, services.ErrEmailRequired) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Email is required!"})
+		return
+	}
+	if errors.Is(err, services.ErrEmailDomainNotAllowed) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Email domain is not allowed!"})
+		return
+	}
+	if errors.Is(err, services.ErrUsernameTaken) {
+		if concealDuplicates {
+			c.JSON(http.StatusAccepted, gin.H{"message": "Registration received"})
+			return
+		}
+		c.JSON(http.StatusConflict, gin.H{"error": "Username is not available!"})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		fmt.Println("error creating user", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to register user!"})
 		return
 	}
 
-	token, err := services.CreateToken(userEntry.Username)
+	if org != "" {
+		recordAudit(services.AuditOrgJoin, userEntry.Username, userEntry.Username, c.ClientIP(), org)
+	}
+
+	if concealDuplicates {
+		c.JSON(http.StatusAccepted, gin.H{"message": "Registration received"})
+		return
+	}
+
+	// The account can't be used until its email address is confirmed
+	if userEntry.Status == services.UserPendingVerification {
+		c.JSON(http.StatusAccepted, gin.H{"message": "Registration received, confirm your email address", "status": userEntry.Status})
+		return
+	}
+
+	token, err := services.CreateOrgToken(userEntry.Username, org)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		return
@@ -39,6 +136,31 @@ func Register(c *gin.Context) {
 
 }
 
+type emailVerificationRequest struct {
+	Token string `json:"token"`
+}
+
+// VerifyEmail POST /verify-email
+func VerifyEmail(c *gin.Context) {
+	var verificationReq emailVerificationRequest
+	if err := c.BindJSON(&verificationReq); err != nil {
+		return
+	}
+
+	username, err := services.VerifyEmail(verificationReq.Token)
+	if errors.Is(err, services.ErrEmailVerificationInvalid) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid or expired verification token!"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	recordAudit(services.AuditEmailVerify, username, username, c.ClientIP(), "")
+	c.JSON(http.StatusOK, gin.H{"Verified user": username})
+}
+
 // Login POST /login
 func Login(c *gin.Context) {
 	var userReq userRequest
@@ -47,22 +169,139 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	wait, err := services.CheckLoginAllowed(userReq.Username, c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+	if wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed login attempts, try again later!"})
+		return
+	}
+
+	// Repeated failures for a username have to solve a challenge first
+	failures, err := services.GetLoginFailureCount(userReq.Username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+	if failures >= services.LoginChallengeThreshold() && !verifyChallenge(c, userReq.Challenge) {
+		return
+	}
+
 	user, err := services.GetUserByUsername(userReq.Username)
 	if err != nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": "User not found!"})
+		// Burn the same bcrypt time as a real check so timing doesn't reveal
+		// whether the username exists
+		err = services.CheckDummyPassword(c.Request.Context(), userReq.Password)
+		if abortIfHashingBusy(c, err) {
+			return
+		}
+
+		err = services.RecordLoginFailure(userReq.Username, c.ClientIP())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+			return
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": invalidCredentialsMessage})
+		return
+	}
+
+	isMatch, err := services.CheckPasswordHashContext(c.Request.Context(), userReq.Password, user.Hash)
+	if abortIfHashingBusy(c, err) {
 		return
 	}
 
-	isMatch := services.CheckPasswordHash(userReq.Password, user.Hash)
 	if isMatch {
-		token, err := services.CreateToken(userReq.Username)
+		// Only reveal the status to someone who knows the password
+		if !services.IsUserActive(user) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Account is not active!", "status": user.Status})
+			return
+		}
+
+		err = services.RecordLoginSuccess(userReq.Username)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err})
 			return
 		}
+
+		org := requestOrg(c)
+
+		// Accepting an invitation joins its org before the membership check
+		if userReq.OrgInvitation != "" {
+			var ok bool
+			org, ok = acceptOrgInvitation(c, userReq.OrgInvitation, userReq.Username, org)
+			if !ok {
+				return
+			}
+		}
+
+		// Inside an org only its members may log in
+		if org != "" {
+			isMember, err := services.IsOrgMember(org, userReq.Username)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+				return
+			}
+			if !isMember {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Not a member of this organization!"})
+				return
+			}
+		}
+
+		isExpired, err := services.IsPasswordExpired(user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+			return
+		}
+
+		// Only hand out a token that can change the password, not a session
+		if isExpired {
+			_, err = services.DeleteSessionInRedis(userReq.Username)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+				return
+			}
+
+			changeToken, err := services.CreatePasswordChangeToken(userReq.Username)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+				return
+			}
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":               "Password expired!",
+				"passwordExpired":     true,
+				"passwordChangeToken": changeToken,
+			})
+			return
+		}
+
+		// A failed upgrade only means trying again on the next login
+		err = services.RehashPasswordIfNeeded(c.Request.Context(), user, userReq.Password)
+		if err != nil {
+			fmt.Println("error re-hashing password", err.Error())
+		}
+
+		token, err := services.CreateOrgToken(userReq.Username, org)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+			return
+		}
+
+		err = services.RecordLastLogin(userReq.Username, c.ClientIP())
+		if err != nil {
+			fmt.Println("error recording last login", err.Error())
+		}
+
 		c.JSON(http.StatusOK, gin.H{"token": token})
 	} else {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Password is incorrect!"})
+		err = services.RecordLoginFailure(userReq.Username, c.ClientIP())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+			return
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": invalidCredentialsMessage})
 	}
 }
 
@@ -96,6 +335,18 @@ func DeleteUser(c *gin.Context) {
 	}
 	var username = token.Claims.(jwt.MapClaims)["username"]
 
+	// Inside an org, only leave it; the account may belong to other orgs
+	if org := requestOrg(c); org != "" {
+		err = services.RemoveOrgMember(org, username.(string))
+		if abortIfOrgMemberError(c, err) {
+			return
+		}
+		recordAudit(services.AuditOrgLeave, username.(string), username.(string), c.ClientIP(), org)
+
+		c.JSON(http.StatusOK, gin.H{"Deleted user": username, "org": org})
+		return
+	}
+
 	// Delete active sessions, if any
 	_, err = services.DeleteSessionInRedis(username.(string))
 	if err != nil {
@@ -132,3 +383,88 @@ func DeleteUserSession(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"Deleted session for user": username})
 }
+
+// RefreshToken POST /refresh
+func RefreshToken(c *gin.Context) {
+	jwtKey := []byte(os.Getenv("JWT_SECRET"))
+	tokenHeader := c.GetHeader("x-auth-token")
+
+	token, err := services.ParseToken(tokenHeader, jwtKey)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid Token!"})
+		return
+	}
+	var username = token.Claims.(jwt.MapClaims)["username"]
+
+	newToken, err := services.RefreshToken(username.(string), requestOrg(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"token": newToken})
+}
+
+// ChangePassword PUT /password
+func ChangePassword(c *gin.Context) {
+	jwtKey := []byte(os.Getenv("JWT_SECRET"))
+	tokenHeader := c.GetHeader("x-auth-token")
+
+	// Either a full session or the restricted token handed out by Login for
+	// expired passwords
+	var username string
+	isExpiredChange := false
+	token, err := services.ParseToken(tokenHeader, jwtKey)
+	if err == nil {
+		username = token.Claims.(jwt.MapClaims)["username"].(string)
+	} else {
+		username, err = services.ParsePasswordChangeToken(tokenHeader, jwtKey)
+		if err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Invalid Token!"})
+			return
+		}
+		isExpiredChange = true
+	}
+
+	var passwordReq changePasswordRequest
+	if err := c.BindJSON(&passwordReq); err != nil {
+		return
+	}
+
+	err = services.ChangePassword(c.Request.Context(), username, passwordReq.CurrentPassword, passwordReq.NewPassword)
+	if abortIfHashingBusy(c, err) || abortIfPolicyViolation(c, err) {
+		return
+	}
+	if errors.Is(err, services.ErrIncorrectPassword) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Password is incorrect!"})
+		return
+	}
+	if errors.Is(err, services.ErrPasswordReused) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password was used recently!"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	if !isExpiredChange {
+		c.JSON(http.StatusOK, gin.H{"message": "Password changed"})
+		return
+	}
+
+	// Swap the restricted token for a full session now the password is fresh
+	err = services.DeletePasswordChangeToken(username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	sessionToken, err := services.CreateToken(username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed", "token": sessionToken})
+}
@@ -2,9 +2,14 @@ package main
 
 import (
 	"auth-api-go/controllers"
+	"auth-api-go/middleware"
 	"auth-api-go/models"
 	"auth-api-go/redis"
+	"auth-api-go/services"
 	"fmt"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -13,40 +18,168 @@ import (
 func main() {
 	redis.ConnectRedis()
 	models.ConnectDatabase()
+	services.StartRoleReaper()
+	services.StartUserPurger()
 
 	// Creates a gin router with default middleware:
 	// logger and recovery (crash-free) middleware
 	router := gin.Default()
 
+	// gin trusts X-Forwarded-For from anyone by default, which would let
+	// clients pick the IP that rate limits and lockouts count against
+	err := router.SetTrustedProxies(trustedProxies())
+	if err != nil {
+		fmt.Println("Invalid TRUSTED_PROXIES", err.Error())
+		return
+	}
+
 	// cors, allow all and new header
 	config := cors.DefaultConfig()
 	config.AllowAllOrigins = true
 	config.AddAllowHeaders("x-auth-token")
 	config.AddAllowHeaders("X-API-Token")
+	config.AddAllowHeaders("X-Org")
+	config.AddExposeHeaders("RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After")
 	router.Use(cors.New(config))
 
 	router.GET("/", controllers.Index)
-	router.POST("/login", controllers.Login)
-	router.POST("/register", controllers.Register)
-	router.GET("/verify", controllers.Verify)
-	router.DELETE("/", controllers.DeleteUser)
-	router.DELETE("/session", controllers.DeleteUserSession)
+	router.GET("/metrics", controllers.Metrics)
+	router.GET("/challenge", middleware.RateLimit("challenge", 60, time.Minute, middleware.KeyByIP), controllers.GetChallenge)
+
+	// Strict limits where every request costs a bcrypt hash
+	passwordRoutes := router.Group("/",
+		middleware.RateLimit("auth", 30, time.Minute, middleware.KeyByIP),
+		middleware.RateLimit("auth_user", 10, time.Minute, middleware.KeyByUsername))
+	{
+		passwordRoutes.POST("/login", middleware.Tenant(), controllers.Login)
+		passwordRoutes.POST("/register", controllers.Register)
+		passwordRoutes.PUT("/password", controllers.ChangePassword)
+	}
+
+	router.POST("/verify-email", middleware.RateLimit("auth", 30, time.Minute, middleware.KeyByIP), controllers.VerifyEmail)
+
+	// Verify is the hot path for every service, so it gets a generous limit
+	router.GET("/verify", middleware.RateLimit("verify", 1200, time.Minute, middleware.KeyByToken), controllers.Verify)
+
+	// Everything a user does here is scoped to the org the request is for
+	userRoutes := router.Group("/", middleware.RateLimit("user", 120, time.Minute, middleware.KeyByToken), middleware.Tenant())
+	{
+		userRoutes.DELETE("/", controllers.DeleteUser)
+		userRoutes.DELETE("/session", controllers.DeleteUserSession)
+		userRoutes.POST("/refresh", controllers.RefreshToken)
+
+		userRoutes.GET("/roles", controllers.GetRoles)
+		userRoutes.GET("/roles/catalog", controllers.GetRoleCatalog)
+		userRoutes.GET("/roles/:role", controllers.DoesUserHaveRole)
+		userRoutes.POST("/roles", controllers.AddRole)
+		userRoutes.DELETE("/roles/:role", controllers.RemoveRole)
+		userRoutes.GET("/groups", controllers.GetGroups)
+		userRoutes.GET("/org/members", controllers.GetOrgMembers)
+		userRoutes.PUT("/org/members/:username", controllers.ChangeOrgMemberRole)
+		userRoutes.DELETE("/org/members/:username", controllers.RemoveOrgMember)
+		userRoutes.GET("/org/invitations", controllers.GetOrgInvitations)
+		userRoutes.POST("/org/invitations", controllers.CreateOrgInvitation)
+		userRoutes.DELETE("/org/invitations/:id", controllers.RevokeOrgInvitation)
+
+		userRoutes.GET("/permissions", controllers.GetPermissions)
+		userRoutes.GET("/permissions/:permission", controllers.HasPermission)
+		userRoutes.POST("/authz/check", controllers.AuthzCheck)
+		userRoutes.POST("/authz/decide", controllers.AuthzDecide)
+		userRoutes.POST("/relations/check", controllers.RelationCheck)
+		userRoutes.GET("/relations/objects", controllers.RelationObjects)
+	}
+
+	adminRoutes := router.Group("/admin", middleware.RateLimit("admin", 120, time.Minute, middleware.KeyByToken))
+	{
+		adminRoutes.GET("/users", controllers.AdminGetUsers)
+		adminRoutes.GET("/users/:username", controllers.AdminGetUser)
+		adminRoutes.POST("/users/:username/roles", controllers.AdminGrantRole)
+		adminRoutes.DELETE("/users/:username/roles/:role", controllers.AdminRevokeRole)
+		adminRoutes.POST("/users/:username/unlock", controllers.AdminUnlockUser)
+		adminRoutes.POST("/users/:username/suspend", controllers.AdminSuspendUser)
+		adminRoutes.POST("/users/:username/reinstate", controllers.AdminReinstateUser)
+		adminRoutes.POST("/users/:username/restore", controllers.AdminRestoreUser)
+
+		adminRoutes.POST("/roles", controllers.AdminCreateRole)
+		adminRoutes.PUT("/roles/:name", controllers.AdminUpdateRole)
+		adminRoutes.DELETE("/roles/:name", controllers.AdminDeleteRole)
+		adminRoutes.GET("/roles/:name/permissions", controllers.AdminGetRolePermissions)
+		adminRoutes.POST("/roles/:name/permissions", controllers.AdminAddRolePermission)
+		adminRoutes.DELETE("/roles/:name/permissions/:permission", controllers.AdminRemoveRolePermission)
+		adminRoutes.GET("/roles/:name/parents", controllers.AdminGetRoleParents)
+		adminRoutes.POST("/roles/:name/parents", controllers.AdminAddRoleParent)
+		adminRoutes.DELETE("/roles/:name/parents/:parent", controllers.AdminRemoveRoleParent)
+
+		adminRoutes.GET("/orgs", controllers.AdminGetOrganizations)
+		adminRoutes.POST("/orgs", controllers.AdminCreateOrganization)
+		adminRoutes.GET("/orgs/:slug/members", controllers.AdminGetOrgMembers)
+		adminRoutes.POST("/orgs/:slug/members", controllers.AdminAddOrgMember)
+		adminRoutes.DELETE("/orgs/:slug/members/:username", controllers.AdminRemoveOrgMember)
+
+		adminRoutes.GET("/groups", controllers.AdminGetGroups)
+		adminRoutes.POST("/groups", controllers.AdminCreateGroup)
+		adminRoutes.DELETE("/groups/:name", controllers.AdminDeleteGroup)
+		adminRoutes.GET("/groups/:name/members", controllers.AdminGetGroupMembers)
+		adminRoutes.POST("/groups/:name/members", controllers.AdminAddGroupMember)
+		adminRoutes.DELETE("/groups/:name/members/:username", controllers.AdminRemoveGroupMember)
+		adminRoutes.GET("/groups/:name/roles", controllers.AdminGetGroupRoles)
+		adminRoutes.POST("/groups/:name/roles", controllers.AdminAddGroupRole)
+		adminRoutes.DELETE("/groups/:name/roles/:role", controllers.AdminRemoveGroupRole)
+
+		adminRoutes.GET("/policies", controllers.AdminGetPolicies)
+		adminRoutes.POST("/policies", controllers.AdminCreatePolicy)
+		adminRoutes.PUT("/policies/:id", controllers.AdminUpdatePolicy)
+		adminRoutes.DELETE("/policies/:id", controllers.AdminDeletePolicy)
 
-	router.GET("/roles", controllers.GetRoles)
-	router.GET("/roles/:role", controllers.DoesUserHaveRole)
-	router.POST("/roles", controllers.AddRole)
+		adminRoutes.GET("/namespaces", controllers.AdminGetNamespaces)
+		adminRoutes.PUT("/namespaces/:name", controllers.AdminSaveNamespace)
 
-	appRoutes := router.Group("/app")
+		adminRoutes.GET("/invites", controllers.AdminGetInvites)
+		adminRoutes.POST("/invites", controllers.AdminCreateInvite)
+		adminRoutes.DELETE("/invites/:id", controllers.AdminDeleteInvite)
+	}
+
+	appRoutes := router.Group("/app", middleware.RateLimit("app", 1200, time.Minute, middleware.KeyByApp))
 	{
 		appRoutes.GET("/verify", controllers.AppVerify)
 		appRoutes.DELETE("/user/:username", controllers.AppDeleteUser)
+		appRoutes.POST("/user/:username/unlock", controllers.AppUnlockUser)
+		appRoutes.POST("/user/:username/suspend", controllers.AppSuspendUser)
+		appRoutes.POST("/user/:username/reinstate", controllers.AppReinstateUser)
+		appRoutes.POST("/user/:username/email-verification", controllers.AppCreateEmailVerification)
+		appRoutes.POST("/user/:username/roles", controllers.AppGrantRole)
+		appRoutes.DELETE("/user/:username/roles/:role", controllers.AppRevokeRole)
+		appRoutes.POST("/authz/check", controllers.AppAuthzCheck)
+		appRoutes.POST("/authz/decide", controllers.AppAuthzDecide)
+		appRoutes.POST("/relations", controllers.AppWriteTuple)
+		appRoutes.DELETE("/relations", controllers.AppDeleteTuple)
+		appRoutes.POST("/relations/check", controllers.AppRelationCheck)
+		appRoutes.POST("/relations/expand", controllers.AppRelationExpand)
+		appRoutes.POST("/relations/objects", controllers.AppRelationObjects)
+
+		appRoutes.GET("/invites", controllers.AppGetInvites)
+		appRoutes.POST("/invites", controllers.AppCreateInvite)
+		appRoutes.DELETE("/invites/:id", controllers.AppDeleteInvite)
 	}
 
 	// By default, it serves on :8080 unless a
 	// PORT environment variable was defined.
-	err := router.Run()
+	err = router.Run()
 	if err != nil {
 		fmt.Println("Error starting Server")
 		return
 	}
 }
+
+// trustedProxies reads TRUSTED_PROXIES, a comma separated list of proxy IPs
+// or CIDRs allowed to set X-Forwarded-For. With none, the peer address is the
+// client IP.
+func trustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
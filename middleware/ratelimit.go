@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"auth-api-go/services"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimitKeyFunc picks what a limit is counted against. An empty key skips
+// the limit for that request.
+type RateLimitKeyFunc func(c *gin.Context) string
+
+// KeyByIP limits each client IP
+func KeyByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// maxKeyedBodyBytes bounds how much of a body KeyByUsername reads; these
+// routes are unauthenticated and their bodies are small
+const maxKeyedBodyBytes = 64 << 10
+
+// KeyByUsername limits each username in a JSON body, e.g. on /login, no
+// matter how many IPs the requests come from.
+func KeyByUsername(c *gin.Context) string {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxKeyedBodyBytes))
+	// Put the body back for the handler; an oversized one is cut short and
+	// fails to bind there
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+
+	var userReq struct {
+		Username string `json:"username"`
+	}
+	if err := json.Unmarshal(body, &userReq); err != nil || userReq.Username == "" {
+		return ""
+	}
+	return "user:" + userReq.Username
+}
+
+// KeyByToken limits each user session, falling back to the client IP for
+// requests without a token. The token is hashed so it never lands in Redis.
+func KeyByToken(c *gin.Context) string {
+	return keyByHeader(c, "x-auth-token", "token:")
+}
+
+// KeyByApp limits each app token, falling back to the client IP.
+func KeyByApp(c *gin.Context) string {
+	return keyByHeader(c, "X-API-Token", "app:")
+}
+
+// keyByHeader keys on the raw value of header. It isn't validated here, which
+// would cost Redis lookups on every request; the handler rejects bad tokens.
+func keyByHeader(c *gin.Context, header string, prefix string) string {
+	value := c.GetHeader(header)
+	if value == "" {
+		return KeyByIP(c)
+	}
+	sum := sha256.Sum256([]byte(value))
+	return prefix + hex.EncodeToString(sum[:16])
+}
+
+// RateLimit allows limit requests per window for each key. name identifies
+// the limit in Redis and in the RATE_LIMIT_<NAME> environment variable, which
+// overrides the defaults as "<limit>/<window>", e.g. RATE_LIMIT_LOGIN=10/1m.
+//
+// Responses carry RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset
+// headers, and a 429 with Retry-After once the limit is used up. If Redis
+// can't be reached the request is let through rather than failing the API.
+func RateLimit(name string, limit int64, window time.Duration, keyFunc RateLimitKeyFunc) gin.HandlerFunc {
+	limit, window = rateLimitFromEnv(name, limit, window)
+
+	return func(c *gin.Context) {
+		key := keyFunc(c)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		result, err := services.CheckRateLimit(name+":"+key, limit, window)
+		if err != nil {
+			fmt.Println("error checking rate limit", err.Error())
+			c.Next()
+			return
+		}
+
+		reset := strconv.Itoa(int(math.Ceil(result.Reset.Seconds())))
+		c.Header("RateLimit-Limit", strconv.FormatInt(result.Limit, 10))
+		c.Header("RateLimit-Remaining", strconv.FormatInt(max(result.Remaining, 0), 10))
+		c.Header("RateLimit-Reset", reset)
+
+		if !result.Allowed {
+			c.Header("Retry-After", reset)
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests, try again later!"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func rateLimitFromEnv(name string, limit int64, window time.Duration) (int64, time.Duration) {
+	value := os.Getenv("RATE_LIMIT_" + strings.ToUpper(name))
+	if value == "" {
+		return limit, window
+	}
+
+	limitText, windowText, found := strings.Cut(value, "/")
+	envLimit, limitErr := strconv.ParseInt(limitText, 10, 64)
+	envWindow, windowErr := time.ParseDuration(windowText)
+	if !found || limitErr != nil || windowErr != nil || envLimit <= 0 || envWindow <= 0 {
+		fmt.Printf("Ignoring invalid RATE_LIMIT_%s=%q\n", strings.ToUpper(name), value)
+		return limit, window
+	}
+	return envLimit, envWindow
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"auth-api-go/services"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Tenant resolves the organization a request is for and stores its slug
+// under "org" for the controllers, empty outside any org. The host and the
+// X-Org header come first, falling back to the org claim of the session
+// token. A session token from a different org than the host or header is
+// refused, so a request never reaches into another tenant.
+func Tenant() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		org, err := services.ResolveOrg(c.Request.Host, c.GetHeader("X-Org"))
+		if errors.Is(err, services.ErrOrgNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Organization not found!"})
+			return
+		}
+		if errors.Is(err, services.ErrOrgMismatch) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Host and X-Org name different organizations!"})
+			return
+		}
+		if err != nil {
+			fmt.Println("error resolving organization", err.Error())
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Error resolving organization!"})
+			return
+		}
+
+		if tokenHeader := c.GetHeader("x-auth-token"); tokenHeader != "" {
+			tokenOrg := services.TokenOrg(tokenHeader)
+			if org == "" {
+				org = tokenOrg
+			} else if tokenOrg != org {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Token is for another organization!"})
+				return
+			}
+		}
+
+		c.Set("org", org)
+		c.Next()
+	}
+}
@@ -6,20 +6,188 @@ import (
 	"gorm.io/gorm"
 	"log"
 	"os"
+	"time"
 )
 
 var DB *gorm.DB
 
 type User struct {
 	gorm.Model
-	Username string `json:"username" gorm:"index:idx_user,unique"`
-	Hash     string `json:"hash"`
+	// Unique among live users only, so a deleted username can register again
+	Username          string     `json:"username" gorm:"index:idx_user_live,unique,where:deleted_at IS NULL"`
+	Hash              string     `json:"hash"`
+	PasswordChangedAt *time.Time `json:"passwordChangedAt"`
+	Email             string     `json:"email" gorm:"index"`
+	LastLoginAt       *time.Time `json:"lastLoginAt"`
+	LastLoginIP       string     `json:"lastLoginIp,omitempty"`
+	// Status is active, suspended, locked or pending-verification
+	Status          string     `json:"status" gorm:"default:active;index"`
+	StatusReason    string     `json:"statusReason,omitempty"`
+	StatusChangedAt *time.Time `json:"statusChangedAt,omitempty"`
+	StatusChangedBy string     `json:"statusChangedBy,omitempty"`
+}
+
+// RoleDefinition is a catalog entry for a role. Only defined roles can be
+// granted, so typos don't silently create new roles.
+type RoleDefinition struct {
+	gorm.Model
+	Name        string `json:"name" gorm:"uniqueIndex"`
+	Description string `json:"description"`
+	CreatedBy   string `json:"createdBy"`
+	Assignable  bool   `json:"assignable"` // users may give it to themselves
+}
+
+// RolePermission grants a permission such as "invoices:write" to everyone
+// holding Role. "invoices:*" and "*" are wildcards.
+type RolePermission struct {
+	gorm.Model
+	Role       string `json:"role" gorm:"index:idx_role_permission,unique"`
+	Permission string `json:"permission" gorm:"index:idx_role_permission,unique"`
+}
+
+// RoleInheritance makes holders of Role also hold Parent and everything
+// Parent inherits, e.g. admin -> editor -> viewer.
+type RoleInheritance struct {
+	gorm.Model
+	Role   string `json:"role" gorm:"index:idx_role_parent,unique"`
+	Parent string `json:"parent" gorm:"index:idx_role_parent,unique"`
+}
+
+// PasswordHistory keeps a user's previous password hashes so they can't be reused
+type PasswordHistory struct {
+	gorm.Model
+	Username string `json:"username" gorm:"index"`
+	Hash     string `json:"-"`
 }
 
 type Roles struct {
 	gorm.Model
 	Username string `json:"username" gorm:"index:idx_user"`
 	Role     string `json:"role"`
+	// Org is the slug of the organization the role applies in, or empty for
+	// roles that apply across the deployment
+	Org string `json:"org,omitempty" gorm:"index"`
+	// ExpiresAt is nil for permanent grants
+	ExpiresAt *time.Time `json:"expiresAt,omitempty" gorm:"index"`
+	GrantedBy string     `json:"grantedBy,omitempty"`
+	// InheritedFrom is set on roles the user only holds through this directly
+	// granted role; such entries aren't stored.
+	InheritedFrom string `json:"inheritedFrom,omitempty" gorm:"-"`
+	// Group is set on roles the user holds through membership of this group;
+	// such entries aren't stored either.
+	Group string `json:"group,omitempty" gorm:"-"`
+}
+
+// Invite lets someone register while registration is invite-only. Only a
+// hash of the code is stored; the code itself is shown once when created.
+type Invite struct {
+	gorm.Model
+	CodeHash  string     `json:"-" gorm:"uniqueIndex"`
+	CreatedBy string     `json:"createdBy"`
+	MaxUses   int        `json:"maxUses"`
+	Uses      int        `json:"uses"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+	Roles     string     `json:"roles"` // comma separated, granted on redemption
+}
+
+// Policy is an attribute based rule written in CEL. Policies whose Action
+// matches a request are evaluated against the subject, resource and
+// environment; a request is allowed when an allow policy matches and no deny
+// policy does.
+type Policy struct {
+	gorm.Model
+	Name        string `json:"name" gorm:"uniqueIndex"`
+	Description string `json:"description"`
+	Action      string `json:"action"` // e.g. "documents:edit", "documents:*" or "*"
+	Effect      string `json:"effect"` // "allow" or "deny"
+	Expression  string `json:"expression"`
+	Enabled     bool   `json:"enabled"`
+	CreatedBy   string `json:"createdBy"`
+}
+
+// RelationNamespace configures the relations objects of one type can have,
+// e.g. "document". Config is the JSON form of services.NamespaceConfig.
+type RelationNamespace struct {
+	gorm.Model
+	Name   string `json:"name" gorm:"uniqueIndex"`
+	Config string `json:"config"`
+}
+
+// RelationTuple says Subject has Relation to Object, e.g. alice is a viewer
+// of document:readme. Subject is a username or a set of users written as
+// "object#relation", e.g. "group:eng#member".
+type RelationTuple struct {
+	gorm.Model
+	Object   string `json:"object" gorm:"index:idx_relation_tuple_live,unique,where:deleted_at IS NULL"`
+	Relation string `json:"relation" gorm:"index:idx_relation_tuple_live,unique,where:deleted_at IS NULL"`
+	Subject  string `json:"subject" gorm:"index:idx_relation_tuple_live,unique,where:deleted_at IS NULL;index"`
+}
+
+// Organization is a tenant. Requests find theirs by Domain, by
+// "<slug>.<TENANT_BASE_DOMAIN>", by the X-Org header or by the token.
+type Organization struct {
+	gorm.Model
+	Slug      string `json:"slug" gorm:"uniqueIndex"`
+	Name      string `json:"name"`
+	Domain    string `json:"domain,omitempty" gorm:"index"`
+	CreatedBy string `json:"createdBy"`
+}
+
+// OrgMember lets Username log in to Org. Members whose Role is "admin" can
+// manage the org's members and invitations.
+type OrgMember struct {
+	gorm.Model
+	Org      string `json:"org" gorm:"index:idx_org_member_live,unique,where:deleted_at IS NULL"`
+	Username string `json:"username" gorm:"index:idx_org_member_live,unique,where:deleted_at IS NULL;index"`
+	Role     string `json:"role" gorm:"default:member"`
+	AddedBy  string `json:"addedBy,omitempty"`
+}
+
+// OrgInvitation asks whoever holds Email to join Org. Only a hash of the
+// token is stored; the token itself is shown once when created.
+type OrgInvitation struct {
+	gorm.Model
+	Org       string    `json:"org" gorm:"index"`
+	Email     string    `json:"email"`
+	TokenHash string    `json:"-" gorm:"uniqueIndex"`
+	Role      string    `json:"role"`
+	Roles     string    `json:"roles"` // comma separated, granted in Org on acceptance
+	InvitedBy string    `json:"invitedBy"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	// AcceptedBy and AcceptedAt are set once the invitation is used
+	AcceptedBy string     `json:"acceptedBy,omitempty"`
+	AcceptedAt *time.Time `json:"acceptedAt,omitempty"`
+}
+
+// Group is a team whose members all hold the group's roles
+type Group struct {
+	gorm.Model
+	Name        string `json:"name" gorm:"uniqueIndex"`
+	Description string `json:"description"`
+	CreatedBy   string `json:"createdBy"`
+}
+
+type GroupMember struct {
+	gorm.Model
+	GroupName string `json:"group" gorm:"index:idx_group_member_live,unique,where:deleted_at IS NULL"`
+	Username  string `json:"username" gorm:"index:idx_group_member_live,unique,where:deleted_at IS NULL;index"`
+	AddedBy   string `json:"addedBy,omitempty"`
+}
+
+type GroupRole struct {
+	gorm.Model
+	GroupName string `json:"group" gorm:"index:idx_group_role,unique"`
+	Role      string `json:"role" gorm:"index:idx_group_role,unique"`
+}
+
+// AuditEvent records a security relevant action, e.g. an account lockout
+type AuditEvent struct {
+	gorm.Model
+	Event    string `json:"event" gorm:"index"`
+	Username string `json:"username" gorm:"index"`
+	Actor    string `json:"actor"`
+	IP       string `json:"ip"`
+	Detail   string `json:"detail"`
 }
 
 func ConnectDatabase() {
@@ -43,14 +211,44 @@ func ConnectDatabase() {
 
 	// Connect to DB
 	dsn := "host=" + pgHost + " user=" + pgUser + " password=" + pgPass + " dbname=" + pgDb + " port=5432 sslmode=disable TimeZone=America/Chicago"
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	// TranslateError maps driver errors such as unique violations to gorm.ErrDuplicatedKey
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{TranslateError: true})
 
 	// Migrate the schema
-	err = db.AutoMigrate(&User{}, &Roles{})
+	err = db.AutoMigrate(&User{}, &Roles{}, &RoleDefinition{}, &RolePermission{}, &RoleInheritance{}, &Policy{}, &RelationNamespace{}, &RelationTuple{}, &Group{}, &GroupMember{}, &GroupRole{}, &Organization{}, &OrgMember{}, &OrgInvitation{}, &PasswordHistory{}, &AuditEvent{}, &Invite{})
 	if err != nil {
 		log.Fatal("Error Migrating DB Schema")
 		return
 	}
 
+	// These indexes counted deleted rows too, so a deleted user's rows blocked
+	// the name's next owner; the _live indexes replace them
+	replacedIndexes := []struct {
+		model interface{}
+		name  string
+	}{
+		{&User{}, "idx_user"},
+		{&RelationTuple{}, "idx_relation_tuple"},
+		{&OrgMember{}, "idx_org_member"},
+		{&GroupMember{}, "idx_group_member"},
+	}
+	for _, index := range replacedIndexes {
+		if db.Migrator().HasIndex(index.model, index.name) {
+			err = db.Migrator().DropIndex(index.model, index.name)
+			if err != nil {
+				log.Fatal("Error Migrating DB Schema")
+				return
+			}
+		}
+	}
+
+	// The built-in admin role always exists in the catalog
+	adminRole := RoleDefinition{Name: "admin", Description: "Manages users and roles", CreatedBy: "system"}
+	err = db.Where(RoleDefinition{Name: adminRole.Name}).FirstOrCreate(&adminRole).Error
+	if err != nil {
+		log.Fatal("Error Seeding Role Catalog")
+		return
+	}
+
 	DB = db
 }
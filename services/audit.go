@@ -0,0 +1,51 @@
+package services
+
+import (
+	"auth-api-go/models"
+)
+
+// Audit event names
+const (
+	AuditLoginLockout     = "login.lockout"
+	AuditAccountUnlock    = "account.unlock"
+	AuditRoleGrant        = "role.grant"
+	AuditRoleRevoke       = "role.revoke"
+	AuditRoleExpire       = "role.expire"
+	AuditPermissionGrant  = "permission.grant"
+	AuditPermissionRevoke = "permission.revoke"
+	AuditPolicyChange     = "policy.change"
+	AuditGroupJoin        = "group.join"
+	AuditGroupLeave       = "group.leave"
+	AuditGroupChange      = "group.change"
+	AuditOrgInvite        = "org.invite"
+	AuditOrgInviteRevoke  = "org.invite.revoke"
+	AuditOrgJoin          = "org.join"
+	AuditOrgRoleChange    = "org.role.change"
+	AuditOrgLeave         = "org.leave"
+	AuditUserSuspend      = "user.suspend"
+	AuditUserReinstate    = "user.reinstate"
+	AuditUserRestore      = "user.restore"
+	AuditUserPurge        = "user.purge"
+	AuditEmailVerify      = "email.verify"
+)
+
+func RecordAuditEvent(event string, username string, actor string, ip string, detail string) error {
+	auditEntry := &models.AuditEvent{
+		Event:    event,
+		Username: username,
+		Actor:    actor,
+		IP:       ip,
+		Detail:   detail,
+	}
+
+	return models.DB.Create(auditEntry).Error
+}
+
+func GetAuditEventsByUsername(username string) ([]models.AuditEvent, error) {
+	var events []models.AuditEvent
+	result := models.DB.Where("username = ?", username).Order("created_at desc").Find(&events)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return events, nil
+}
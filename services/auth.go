@@ -14,20 +14,99 @@ import (
 
 type Claims struct {
 	Username string `json:"username"`
+	Scope    string `json:"scope,omitempty"`
+	// Org is the organization the session was opened in, if any
+	Org string `json:"org,omitempty"`
+	// Roles and Permissions are only embedded when TOKEN_EMBED asks for them
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	// AuthzOmitted is set when they didn't fit under TOKEN_EMBED_MAX_BYTES,
+	// telling services to ask the API instead
+	AuthzOmitted bool `json:"authzOmitted,omitempty"`
 	jwt.StandardClaims
 }
 
+// PasswordChangeScope marks tokens that may only be used to change an expired password
+const PasswordChangeScope = "password_change"
+
 func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
-	return string(bytes), err
+	return HashPasswordContext(context.Background(), password)
+}
+
+// HashPasswordContext hashes password on the bounded hashing pool, peppered
+// with the current pepper if one is configured. It fails fast with
+// ErrHashQueueFull when the pool is saturated.
+func HashPasswordContext(ctx context.Context, password string) (string, error) {
+	peppers, version, err := loadPeppers()
+	if err != nil {
+		return "", err
+	}
+	peppered, err := applyPepper(peppers, version, password)
+	if err != nil {
+		return "", err
+	}
+
+	var bytes []byte
+	var hashErr error
+	err = getHashPool().run(ctx, func() {
+		bytes, hashErr = bcrypt.GenerateFromPassword([]byte(peppered), 14)
+	})
+	if err != nil {
+		return "", err
+	}
+	if hashErr != nil {
+		return "", hashErr
+	}
+	return joinPepperVersion(version, string(bytes)), nil
 }
 
 func CheckPasswordHash(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+	isMatch, err := CheckPasswordHashContext(context.Background(), password, hash)
+	return err == nil && isMatch
+}
+
+// CheckPasswordHashContext compares password against hash on the bounded
+// hashing pool. The error is only set when the comparison could not run.
+func CheckPasswordHashContext(ctx context.Context, password, hash string) (bool, error) {
+	version, bcryptHash := splitPepperVersion(hash)
+	peppers, _, err := loadPeppers()
+	if err != nil {
+		return false, err
+	}
+	peppered, err := applyPepper(peppers, version, password)
+	if err != nil {
+		return false, err
+	}
+
+	var compareErr error
+	err = getHashPool().run(ctx, func() {
+		compareErr = bcrypt.CompareHashAndPassword([]byte(bcryptHash), []byte(peppered))
+	})
+	if err != nil {
+		return false, err
+	}
+	return compareErr == nil, nil
+}
+
+// dummyHash is a cost 14 bcrypt hash of a random string nobody knows. It is
+// compared against when a username doesn't exist, so a failed login for an
+// unknown user takes as long as one for a real user.
+const dummyHash = "$2a$14$UZMGWUY9YN22AhM/OQUkCu2hGo6zYlemw2Tp2dHLCAWaVNHr/EH.C"
+
+// CheckDummyPassword spends the same effort as CheckPasswordHashContext and
+// always reports no match.
+func CheckDummyPassword(ctx context.Context, password string) error {
+	_, err := CheckPasswordHashContext(ctx, password, dummyHash)
+	return err
 }
 
 func CreateToken(username string) (string, error) {
+	return CreateOrgToken(username, "")
+}
+
+// CreateOrgToken returns username's session token for org. A user has one
+// session, so opening one in another org replaces the current one.
+func CreateOrgToken(username string, org string) (string, error) {
 	ctx := context.Background()
 
 	// See if token exists in redis
@@ -41,7 +120,7 @@ func CreateToken(username string) (string, error) {
 		}
 	}
 
-	if val != "" {
+	if val != "" && TokenOrg(val) == org {
 		fmt.Println("token found in redis; returning it")
 		return val, nil
 	}
@@ -53,11 +132,16 @@ func CreateToken(username string) (string, error) {
 	// Create the JWT claims, which includes the username and expiry time
 	claims := &Claims{
 		Username: username,
+		Org:      org,
 		StandardClaims: jwt.StandardClaims{
 			// In JWT, the expiry time is expressed as unix milliseconds
 			ExpiresAt: expirationTime.Unix(),
 		},
 	}
+	err = embedAuthzClaims(claims)
+	if err != nil {
+		return "", err
+	}
 	// Declare the token with the algorithm used for signing, and the claims
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	// Create the JWT string
@@ -78,6 +162,16 @@ func CreateToken(username string) (string, error) {
 	return tokenString, nil
 }
 
+// RefreshToken replaces username's session in org with a new token, picking
+// up any role or permission changes since the old one was issued.
+func RefreshToken(username string, org string) (string, error) {
+	_, err := DeleteSessionInRedis(username)
+	if err != nil {
+		return "", err
+	}
+	return CreateOrgToken(username, org)
+}
+
 func ParseToken(tokenHeader string, jwtKey []byte) (*jwt.Token, error) {
 	if tokenHeader == "" {
 		return nil, errors.New("missing token")
@@ -112,6 +206,16 @@ func ParseToken(tokenHeader string, jwtKey []byte) (*jwt.Token, error) {
 		return nil, errors.New("forbidden")
 	}
 
+	// Suspended users are refused even if a session slipped through
+	status, err := redis.REDIS.Get(ctx, username.(string)+"-status").Result()
+	if err != nil && err.Error() != "redis: nil" {
+		fmt.Println("error with redis get", err.Error())
+		return nil, fmt.Errorf("error with redis get: %v", err)
+	}
+	if status != "" && status != UserActive {
+		return nil, ErrUserNotActive
+	}
+
 	return token, nil
 }
 
@@ -131,3 +235,80 @@ func GetUsernameFromToken(tokenHeader string, jwtKey []byte) (string, error) {
 	username := token.Claims.(jwt.MapClaims)["username"]
 	return username.(string), nil
 }
+
+// CreatePasswordChangeToken issues a short-lived token for a user whose
+// password has expired. It is stored apart from the session, so ParseToken
+// rejects it and it can only be used with ParsePasswordChangeToken.
+func CreatePasswordChangeToken(username string) (string, error) {
+	ctx := context.Background()
+	jwtKey := []byte(os.Getenv("JWT_SECRET"))
+
+	expirationTime := time.Now().Add(15 * time.Minute)
+
+	claims := &Claims{
+		Username: username,
+		Scope:    PasswordChangeScope,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: expirationTime.Unix(),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tokenString, err := token.SignedString(jwtKey)
+	if err != nil {
+		return "", fmt.Errorf("error with creating token: %v", err)
+	}
+
+	err = redis.REDIS.Set(ctx, username+"-password-change", tokenString, time.Until(expirationTime)).Err()
+	if err != nil {
+		fmt.Println("error with redis set", err.Error())
+		return "", fmt.Errorf("error with redis set: %v", err)
+	}
+
+	return tokenString, nil
+}
+
+// ParsePasswordChangeToken validates a token from CreatePasswordChangeToken
+// and returns the username it was issued to.
+func ParsePasswordChangeToken(tokenHeader string, jwtKey []byte) (string, error) {
+	if tokenHeader == "" {
+		return "", errors.New("missing token")
+	}
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenHeader, claims, func(token *jwt.Token) (interface{}, error) {
+		return jwtKey, nil
+	})
+	if err != nil {
+		return "", errors.New("unable to parse token")
+	}
+
+	if claims.Scope != PasswordChangeScope {
+		return "", errors.New("forbidden")
+	}
+
+	ctx := context.Background()
+	val, err := redis.REDIS.Get(ctx, claims.Username+"-password-change").Result()
+	if err != nil {
+		if err.Error() == "redis: nil" {
+			return "", errors.New("forbidden")
+		}
+		fmt.Println("error with redis get", err.Error())
+		return "", fmt.Errorf("error with redis get: %v", err)
+	}
+
+	if val != tokenHeader {
+		return "", errors.New("forbidden")
+	}
+
+	return claims.Username, nil
+}
+
+func DeletePasswordChangeToken(username string) error {
+	ctx := context.Background()
+	err := redis.REDIS.Del(ctx, username+"-password-change").Err()
+	if err != nil {
+		fmt.Println("error with redis del", err.Error())
+		return fmt.Errorf("error with redis del: %v", err)
+	}
+	return nil
+}
@@ -1,9 +1,11 @@
 package services
 
 import (
+	"context"
 	"testing"
 
 	"github.com/golang-jwt/jwt"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestHashPassword(t *testing.T) {
@@ -227,3 +229,49 @@ func TestGetUsernameFromToken_InvalidToken(t *testing.T) {
 		t.Error("GetUsernameFromToken() should return empty string for invalid token")
 	}
 }
+
+func TestParsePasswordChangeToken_WrongScope(t *testing.T) {
+	jwtKey := []byte("testsecret")
+
+	claims := &Claims{
+		Username: "testuser",
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: 9999999999,
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tokenString, err := token.SignedString(jwtKey)
+	if err != nil {
+		t.Fatalf("Failed to create test token: %v", err)
+	}
+
+	username, err := ParsePasswordChangeToken(tokenString, jwtKey)
+	if err == nil {
+		t.Error("ParsePasswordChangeToken() should reject a session token")
+	}
+	if username != "" {
+		t.Error("ParsePasswordChangeToken() should return empty string for a session token")
+	}
+}
+
+func TestParsePasswordChangeToken_EmptyToken(t *testing.T) {
+	_, err := ParsePasswordChangeToken("", []byte("testsecret"))
+	if err == nil || err.Error() != "missing token" {
+		t.Errorf("ParsePasswordChangeToken() error = %v, want 'missing token'", err)
+	}
+}
+
+func TestCheckDummyPassword(t *testing.T) {
+	cost, err := bcrypt.Cost([]byte(dummyHash))
+	if err != nil {
+		t.Fatalf("dummyHash is not a bcrypt hash: %v", err)
+	}
+	if cost != 14 {
+		t.Errorf("dummyHash cost = %v, want 14 to match real hashes", cost)
+	}
+
+	err = CheckDummyPassword(context.Background(), "password123")
+	if err != nil {
+		t.Errorf("CheckDummyPassword() error = %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package services
+
+import "errors"
+
+// maxAuthzChecks caps how many questions one CheckAuthorization call answers
+const maxAuthzChecks = 100
+
+var ErrTooManyAuthzChecks = errors.New("too many authorization checks in one request")
+
+type ResourceAction struct {
+	Resource string `json:"resource"`
+	Action   string `json:"action"`
+}
+
+// AuthzCheck lists roles, permissions and resource actions to decide for a
+// user. A resource action is allowed by the "resource:action" permission.
+type AuthzCheck struct {
+	Roles       []string         `json:"roles"`
+	Permissions []string         `json:"permissions"`
+	Actions     []ResourceAction `json:"actions"`
+	// Org is the tenant whose roles are checked
+	Org string `json:"-"`
+}
+
+type ActionDecision struct {
+	ResourceAction
+	Allowed bool `json:"allowed"`
+}
+
+type AuthzDecisions struct {
+	Roles       map[string]bool  `json:"roles"`
+	Permissions map[string]bool  `json:"permissions"`
+	Actions     []ActionDecision `json:"actions"`
+}
+
+// CheckAuthorization decides every item in check for username from a single
+// lookup of their effective roles. Like DecidePolicy, a check.Org the user
+// isn't a member of fails with ErrNotOrgMember.
+func CheckAuthorization(username string, check AuthzCheck) (*AuthzDecisions, error) {
+	if len(check.Roles)+len(check.Permissions)+len(check.Actions) > maxAuthzChecks {
+		return nil, ErrTooManyAuthzChecks
+	}
+
+	if check.Org != "" {
+		isMember, err := IsOrgMember(check.Org, username)
+		if err != nil {
+			return nil, err
+		}
+		if !isMember {
+			return nil, ErrNotOrgMember
+		}
+	}
+
+	decisions := &AuthzDecisions{
+		Roles:       make(map[string]bool),
+		Permissions: make(map[string]bool),
+		Actions:     []ActionDecision{},
+	}
+
+	roles, err := GetOrgRolesByUsername(username, check.Org)
+	if err != nil {
+		return nil, err
+	}
+
+	held := make(map[string]bool)
+	for _, role := range roles {
+		held[role.Role] = true
+	}
+	for _, role := range check.Roles {
+		decisions.Roles[role] = held[role]
+	}
+
+	if len(check.Permissions) == 0 && len(check.Actions) == 0 {
+		return decisions, nil
+	}
+
+	granted, err := getPermissionsForRoles(roles)
+	if err != nil {
+		return nil, err
+	}
+	for _, permission := range check.Permissions {
+		decisions.Permissions[permission] = anyPermissionMatches(granted, permission)
+	}
+	for _, action := range check.Actions {
+		permission := action.Resource + ":" + action.Action
+		decisions.Actions = append(decisions.Actions, ActionDecision{
+			ResourceAction: action,
+			Allowed:        validatePermission(permission) == nil && anyPermissionMatches(granted, permission),
+		})
+	}
+
+	return decisions, nil
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestCheckAuthorization(t *testing.T) {
+	mock, cleanup := setupRoleMockDB(t)
+	defer cleanup()
+	expectEmbeddedRoles(mock)
+
+	decisions, err := CheckAuthorization("testuser", AuthzCheck{
+		Roles:       []string{"viewer", "admin"},
+		Permissions: []string{"documents:read", "documents:delete"},
+		Actions: []ResourceAction{
+			{Resource: "documents", Action: "write"},
+			{Resource: "invoices", Action: "write"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CheckAuthorization() error = %v", err)
+	}
+
+	if want := map[string]bool{"viewer": true, "admin": false}; !reflect.DeepEqual(decisions.Roles, want) {
+		t.Errorf("CheckAuthorization() roles = %v, want %v", decisions.Roles, want)
+	}
+	if want := map[string]bool{"documents:read": true, "documents:delete": false}; !reflect.DeepEqual(decisions.Permissions, want) {
+		t.Errorf("CheckAuthorization() permissions = %v, want %v", decisions.Permissions, want)
+	}
+	if len(decisions.Actions) != 2 || !decisions.Actions[0].Allowed || decisions.Actions[1].Allowed {
+		t.Errorf("CheckAuthorization() actions = %+v, want documents:write allowed only", decisions.Actions)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestCheckAuthorization_RolesOnly(t *testing.T) {
+	mock, cleanup := setupRoleMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "roles" WHERE (username = $1 AND (org = '' OR org = $2) AND (expires_at IS NULL OR expires_at > $3))`)).
+		WithArgs("testuser", "", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "deleted_at", "username", "role"}))
+	expectGroupRoles(mock, "testuser")
+
+	decisions, err := CheckAuthorization("testuser", AuthzCheck{Roles: []string{"admin"}})
+	if err != nil {
+		t.Fatalf("CheckAuthorization() error = %v", err)
+	}
+	if decisions.Roles["admin"] {
+		t.Error("CheckAuthorization() should deny roles the user doesn't hold")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestCheckAuthorization_NotOrgMember(t *testing.T) {
+	mock, cleanup := setupRoleMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "org_members" WHERE (org = $1 AND username = $2)`)).
+		WithArgs("acme", "testuser").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	_, err := CheckAuthorization("testuser", AuthzCheck{Roles: []string{"admin"}, Org: "acme"})
+	if !errors.Is(err, ErrNotOrgMember) {
+		t.Errorf("CheckAuthorization() error = %v, want %v", err, ErrNotOrgMember)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestCheckAuthorization_TooMany(t *testing.T) {
+	_, err := CheckAuthorization("testuser", AuthzCheck{Roles: make([]string, maxAuthzChecks+1)})
+	if !errors.Is(err, ErrTooManyAuthzChecks) {
+		t.Errorf("CheckAuthorization() error = %v, want %v", err, ErrTooManyAuthzChecks)
+	}
+}
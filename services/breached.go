@@ -0,0 +1,84 @@
+package services
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// IsPasswordBreached looks password up in a local breached-password list.
+//
+// The file holds one uppercase hex SHA-1 per line, optionally followed by
+// ":<count>", sorted by hash. This is the format of the "ordered by hash"
+// Have I Been Pwned download, so the file can be used as-is. It is searched
+// with a binary search over byte offsets, so it is never loaded into memory.
+func IsPasswordBreached(path string, password string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("error opening breached password list: %v", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return false, fmt.Errorf("error reading breached password list: %v", err)
+	}
+
+	sum := sha1.Sum([]byte(password))
+	target := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	// Candidate lines are the ones starting in [lo, hi)
+	lo, hi := int64(0), info.Size()
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+
+		start, line, err := lineAtOrAfter(file, mid)
+		if err != nil {
+			return false, fmt.Errorf("error reading breached password list: %v", err)
+		}
+		if start >= hi {
+			hi = mid
+			continue
+		}
+
+		hash, _, _ := strings.Cut(strings.TrimSpace(line), ":")
+		switch strings.Compare(strings.ToUpper(hash), target) {
+		case 0:
+			return true, nil
+		case -1:
+			lo = start + int64(len(line))
+		default:
+			hi = mid
+		}
+	}
+
+	return false, nil
+}
+
+// lineAtOrAfter returns the first line starting at or after offset, including
+// its trailing newline, and where it starts.
+func lineAtOrAfter(file *os.File, offset int64) (int64, string, error) {
+	start := offset
+	if offset > 0 {
+		// Skip the rest of the line offset falls in, unless offset is
+		// already the start of a line
+		reader := bufio.NewReader(io.NewSectionReader(file, offset-1, 1<<62))
+		skipped, err := reader.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, "", err
+		}
+		start = offset - 1 + int64(len(skipped))
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(file, start, 1<<62))
+	line, err := reader.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, "", err
+	}
+	return start, line, nil
+}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newCaptchaStub(t *testing.T, success bool) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("Failed to parse captcha form: %v", err)
+		}
+		if r.PostForm.Get("secret") != "captcha-secret" || r.PostForm.Get("response") != "client-token" {
+			t.Errorf("Unexpected captcha form: %v", r.PostForm)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"success": ` + strconv.FormatBool(success) + `}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCaptchaChallenge_Verify(t *testing.T) {
+	server := newCaptchaStub(t, true)
+	challenge := &CaptchaChallenge{VerifyURL: server.URL, Secret: "captcha-secret", Client: server.Client()}
+
+	err := challenge.Verify(context.Background(), "client-token", "10.0.0.1")
+	if err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+}
+
+func TestCaptchaChallenge_Rejected(t *testing.T) {
+	server := newCaptchaStub(t, false)
+	challenge := &CaptchaChallenge{VerifyURL: server.URL, Secret: "captcha-secret", Client: server.Client()}
+
+	err := challenge.Verify(context.Background(), "client-token", "10.0.0.1")
+	if !errors.Is(err, ErrChallengeFailed) {
+		t.Errorf("Verify() error = %v, want %v", err, ErrChallengeFailed)
+	}
+}
+
+func TestCaptchaChallenge_Missing(t *testing.T) {
+	challenge := &CaptchaChallenge{VerifyURL: "http://127.0.0.1:0", Client: http.DefaultClient}
+
+	err := challenge.Verify(context.Background(), "", "10.0.0.1")
+	if !errors.Is(err, ErrChallengeRequired) {
+		t.Errorf("Verify() error = %v, want %v", err, ErrChallengeRequired)
+	}
+}
+
+func solveProofOfWork(challenge string, difficulty int) string {
+	for counter := 0; ; counter++ {
+		solution := challenge + ":" + strconv.Itoa(counter)
+		sum := sha256.Sum256([]byte(solution))
+		if leadingZeroBits(sum[:]) >= difficulty {
+			return solution
+		}
+	}
+}
+
+func TestProofOfWorkChallenge_Verify(t *testing.T) {
+	mock := setupMockRedis(t)
+	pow := &ProofOfWorkChallenge{Secret: []byte("testsecret"), Difficulty: 8, TTL: time.Minute}
+
+	issued, err := pow.Issue(context.Background())
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	solution := solveProofOfWork(issued["challenge"].(string), 8)
+
+	// The TTL depends on the clock, so only the command and key are matched
+	matchKey := func(expected, actual []interface{}) error {
+		if actual[0] != "set" || !strings.HasPrefix(actual[1].(string), "pow:") || actual[len(actual)-1] != "nx" {
+			return fmt.Errorf("unexpected command %v", actual)
+		}
+		return nil
+	}
+	mock.CustomMatch(matchKey).ExpectSetNX("pow:", 1, time.Minute).SetVal(true)
+	mock.CustomMatch(matchKey).ExpectSetNX("pow:", 1, time.Minute).SetVal(false)
+
+	err = pow.Verify(context.Background(), solution, "10.0.0.1")
+	if err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+
+	// Replaying the same solution must fail
+	err = pow.Verify(context.Background(), solution, "10.0.0.1")
+	if !errors.Is(err, ErrChallengeFailed) {
+		t.Errorf("Verify() replay error = %v, want %v", err, ErrChallengeFailed)
+	}
+}
+
+func TestProofOfWorkChallenge_Invalid(t *testing.T) {
+	pow := &ProofOfWorkChallenge{Secret: []byte("testsecret"), Difficulty: 8, TTL: time.Minute}
+
+	issued, err := pow.Issue(context.Background())
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	challenge := issued["challenge"].(string)
+
+	expired := &ProofOfWorkChallenge{Secret: []byte("testsecret"), Difficulty: 8, TTL: -time.Minute}
+	expiredIssued, err := expired.Issue(context.Background())
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+
+	other := &ProofOfWorkChallenge{Secret: []byte("othersecret"), Difficulty: 8, TTL: time.Minute}
+	otherIssued, err := other.Issue(context.Background())
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		solution string
+	}{
+		{"malformed", "not-a-solution"},
+		{"unsolved", challenge + ":x"},
+		{"expired", solveProofOfWork(expiredIssued["challenge"].(string), 8)},
+		{"forged", solveProofOfWork(otherIssued["challenge"].(string), 8)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := pow.Verify(context.Background(), tt.solution, "10.0.0.1")
+			if !errors.Is(err, ErrChallengeFailed) {
+				t.Errorf("Verify() error = %v, want %v", err, ErrChallengeFailed)
+			}
+		})
+	}
+}
+
+func TestGetChallengeProvider(t *testing.T) {
+	t.Setenv("CHALLENGE_PROVIDER", "")
+	provider, err := GetChallengeProvider()
+	if err != nil || provider != nil {
+		t.Errorf("GetChallengeProvider() = %v, %v, want nil provider", provider, err)
+	}
+
+	t.Setenv("CHALLENGE_PROVIDER", "pow")
+	t.Setenv("CHALLENGE_SECRET", "")
+	t.Setenv("JWT_SECRET", "jwt-secret")
+	_, err = GetChallengeProvider()
+	if err == nil {
+		t.Error("GetChallengeProvider() should return error without CHALLENGE_SECRET")
+	}
+
+	t.Setenv("CHALLENGE_SECRET", "challenge-secret")
+	provider, err = GetChallengeProvider()
+	if _, ok := provider.(*ProofOfWorkChallenge); !ok || err != nil {
+		t.Errorf("GetChallengeProvider() = %v, %v, want proof of work", provider, err)
+	}
+
+	t.Setenv("CHALLENGE_PROVIDER", "captcha")
+	_, err = GetChallengeProvider()
+	if err == nil {
+		t.Error("GetChallengeProvider() should return error without CAPTCHA_VERIFY_URL")
+	}
+}
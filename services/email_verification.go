@@ -0,0 +1,94 @@
+package services
+
+import (
+	"auth-api-go/models"
+	"auth-api-go/redis"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrEmailVerificationInvalid    = errors.New("email verification token is invalid or expired")
+	ErrEmailVerificationNotPending = errors.New("user is not waiting for email verification")
+)
+
+// emailVerificationTTL reads EMAIL_VERIFICATION_TTL_HOURS, how long a
+// verification token can be used
+func emailVerificationTTL() time.Duration {
+	return time.Duration(envInt("EMAIL_VERIFICATION_TTL_HOURS", 24)) * time.Hour
+}
+
+func emailVerificationKey(token string) string {
+	return "email-verification:" + hashInviteCode(token)
+}
+
+// CreateEmailVerification issues a token confirming username's email
+// address. Only users in pending-verification can get one. Like invitations,
+// the token is only returned here; mailing it to the user is up to the caller.
+func CreateEmailVerification(username string) (string, error) {
+	user, err := GetUserByUsername(username)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", ErrUserNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	if user.Status != UserPendingVerification {
+		return "", ErrEmailVerificationNotPending
+	}
+
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("error generating verification token: %v", err)
+	}
+	token := hex.EncodeToString(raw)
+
+	ctx := context.Background()
+	// Keyed to the account, not the name, which a later account could reuse
+	err = redis.REDIS.Set(ctx, emailVerificationKey(token), user.ID, emailVerificationTTL()).Err()
+	if err != nil {
+		fmt.Println("error with redis set", err.Error())
+		return "", fmt.Errorf("error with redis set: %v", err)
+	}
+
+	return token, nil
+}
+
+// VerifyEmail redeems token, activating the user it was issued for, and
+// returns their username. A token works once, and not at all once the user
+// has been given another status, e.g. suspended, in the meantime.
+func VerifyEmail(token string) (string, error) {
+	ctx := context.Background()
+	userID, err := redis.REDIS.GetDel(ctx, emailVerificationKey(token)).Result()
+	if err != nil {
+		if err.Error() == "redis: nil" {
+			return "", ErrEmailVerificationInvalid
+		}
+		fmt.Println("error with redis getdel", err.Error())
+		return "", fmt.Errorf("error with redis getdel: %v", err)
+	}
+
+	var user models.User
+	err = models.DB.First(&user, "id = ?", userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", ErrEmailVerificationInvalid
+	}
+	if err != nil {
+		return "", err
+	}
+	if user.Status != UserPendingVerification {
+		return "", ErrEmailVerificationInvalid
+	}
+
+	err = setUserStatus(user.Username, UserActive, "", "email-verification")
+	if err != nil {
+		return "", err
+	}
+	return user.Username, nil
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestVerifyEmail(t *testing.T) {
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+	redisMock := setupMockRedis(t)
+
+	redisMock.ExpectGetDel(emailVerificationKey("verifytoken")).SetVal("4")
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE id = $1 AND "users"."deleted_at" IS NULL ORDER BY "users"."id" LIMIT $2`)).
+		WithArgs("4", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "status"}).AddRow(4, "testuser", UserPendingVerification))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "users" SET`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	redisMock.ExpectDel("testuser-status").SetVal(0)
+
+	username, err := VerifyEmail("verifytoken")
+	if err != nil {
+		t.Fatalf("VerifyEmail() error = %v", err)
+	}
+	if username != "testuser" {
+		t.Errorf("VerifyEmail() = %q, want testuser", username)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+	if err := redisMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled redis expectations: %v", err)
+	}
+}
+
+func TestVerifyEmail_NotPending(t *testing.T) {
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+	redisMock := setupMockRedis(t)
+
+	// A user suspended after registering can't verify their way back in
+	redisMock.ExpectGetDel(emailVerificationKey("verifytoken")).SetVal("4")
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE id = $1`)).
+		WithArgs("4", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "status"}).AddRow(4, "testuser", UserSuspended))
+
+	_, err := VerifyEmail("verifytoken")
+	if !errors.Is(err, ErrEmailVerificationInvalid) {
+		t.Errorf("VerifyEmail() error = %v, want %v", err, ErrEmailVerificationInvalid)
+	}
+}
+
+func TestCreateEmailVerification_NotPending(t *testing.T) {
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE username = $1`)).
+		WithArgs("testuser", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "status"}).AddRow(4, "testuser", UserActive))
+
+	_, err := CreateEmailVerification("testuser")
+	if !errors.Is(err, ErrEmailVerificationNotPending) {
+		t.Errorf("CreateEmailVerification() error = %v, want %v", err, ErrEmailVerificationNotPending)
+	}
+}
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"auth-api-go/models"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrGroupExists         = errors.New("group already exists")
+	ErrGroupNotFound       = errors.New("group not found")
+	ErrGroupMemberExists   = errors.New("user is already a member of the group")
+	ErrGroupMemberNotFound = errors.New("user is not a member of the group")
+	ErrGroupRoleExists     = errors.New("group already has role")
+	ErrGroupRoleNotFound   = errors.New("group does not have role")
+)
+
+func GetGroups() ([]models.Group, error) {
+	var groups []models.Group
+	result := models.DB.Order("name").Find(&groups)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return groups, nil
+}
+
+// GetGroup returns ErrGroupNotFound when there is no group called name
+func GetGroup(name string) (*models.Group, error) {
+	var group models.Group
+	err := models.DB.Where("name = ?", name).First(&group).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrGroupNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+func CreateGroup(name string, description string, createdBy string) (*models.Group, error) {
+	groupEntry := &models.Group{
+		Name:        name,
+		Description: description,
+		CreatedBy:   createdBy,
+	}
+
+	err := models.DB.Create(groupEntry).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return nil, ErrGroupExists
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return groupEntry, nil
+}
+
+// DeleteGroup removes a group along with its memberships and roles, so its
+// members lose the roles they held through it straight away. The group row is
+// deleted outright so the name can be used again, and the members whose
+// sessions end are the rows the delete actually removed.
+func DeleteGroup(name string) error {
+	var members []models.GroupMember
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Where("name = ?", name).Delete(&models.Group{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrGroupNotFound
+		}
+
+		err := tx.Unscoped().Clauses(clause.Returning{Columns: []clause.Column{{Name: "username"}}}).
+			Where("group_name = ?", name).Delete(&members).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Unscoped().Where("group_name = ?", name).Delete(&models.GroupRole{}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	usernames := make([]string, 0, len(members))
+	for _, member := range members {
+		usernames = append(usernames, member.Username)
+	}
+	return rolesChanged(usernames...)
+}
+
+func GetGroupMembers(name string) ([]models.GroupMember, error) {
+	var members []models.GroupMember
+	result := models.DB.Order("username").Find(&members, "group_name = ?", name)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return members, nil
+}
+
+// GetGroupsByUsername returns the names of the groups username belongs to
+func GetGroupsByUsername(username string) ([]string, error) {
+	groups := []string{}
+	result := models.DB.Model(&models.GroupMember{}).Order("group_name").
+		Where("username = ?", username).Pluck("group_name", &groups)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return groups, nil
+}
+
+func AddGroupMember(name string, username string, addedBy string) error {
+	if _, err := GetGroup(name); err != nil {
+		return err
+	}
+
+	memberEntry := &models.GroupMember{
+		GroupName: name,
+		Username:  username,
+		AddedBy:   addedBy,
+	}
+
+	err := models.DB.Create(memberEntry).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrGroupMemberExists
+	}
+	if err != nil {
+		return err
+	}
+
+	return rolesChanged(username)
+}
+
+// RemoveGroupMember deletes the membership outright, taking the group's
+// roles away from username at once.
+func RemoveGroupMember(name string, username string) error {
+	result := models.DB.Unscoped().Where("group_name = ? AND username = ?", name, username).Delete(&models.GroupMember{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrGroupMemberNotFound
+	}
+	return rolesChanged(username)
+}
+
+func GetGroupRoles(name string) ([]models.GroupRole, error) {
+	var roles []models.GroupRole
+	result := models.DB.Order("role").Find(&roles, "group_name = ?", name)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return roles, nil
+}
+
+// AddGroupRole gives every member of the group role. The role has to be
+// defined in the catalog.
+func AddGroupRole(name string, role string) error {
+	if _, err := GetGroup(name); err != nil {
+		return err
+	}
+	if _, err := GetRoleDefinition(role); err != nil {
+		return err
+	}
+
+	roleEntry := &models.GroupRole{
+		GroupName: name,
+		Role:      role,
+	}
+
+	err := models.DB.Create(roleEntry).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrGroupRoleExists
+	}
+	if err != nil {
+		return err
+	}
+
+	return groupMembersChanged(name)
+}
+
+func RemoveGroupRole(name string, role string) error {
+	result := models.DB.Unscoped().Where("group_name = ? AND role = ?", name, role).Delete(&models.GroupRole{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrGroupRoleNotFound
+	}
+	return groupMembersChanged(name)
+}
+
+// getGroupRoleGrants returns the roles username holds through their groups.
+// The soft-delete scope only covers group_roles, so memberships deleted with
+// a previous owner of the username are filtered out by hand.
+func getGroupRoleGrants(username string) ([]models.GroupRole, error) {
+	var grants []models.GroupRole
+	result := models.DB.
+		Joins("JOIN group_members ON group_members.group_name = group_roles.group_name AND group_members.deleted_at IS NULL").
+		Where("group_members.username = ?", username).
+		Order("group_roles.group_name, group_roles.role").
+		Find(&grants)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return grants, nil
+}
+
+// groupMembersChanged ends the sessions of everyone in the group when
+// tokens embed roles, like roleHoldersChanged does for a role.
+func groupMembersChanged(name string) error {
+	embedRoles, embedPermissions, _ := tokenEmbedConfig()
+	if !embedRoles && !embedPermissions {
+		return nil
+	}
+
+	var usernames []string
+	result := models.DB.Model(&models.GroupMember{}).Where("group_name = ?", name).Pluck("username", &usernames)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	return rolesChanged(usernames...)
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var groupRoleColumns = []string{"id", "created_at", "updated_at", "deleted_at", "group_name", "role"}
+
+// expectGroupRoles expects the roles username holds through groups to be
+// read, returning grants as group, role pairs
+func expectGroupRoles(mock sqlmock.Sqlmock, username string, grants ...string) {
+	rows := sqlmock.NewRows(groupRoleColumns)
+	for i := 0; i+1 < len(grants); i += 2 {
+		rows.AddRow(i+1, nil, nil, nil, grants[i], grants[i+1])
+	}
+	mock.ExpectQuery(`SELECT .* FROM "group_roles" JOIN group_members ON group_members.group_name = group_roles.group_name AND group_members.deleted_at IS NULL WHERE group_members.username = \$1`).
+		WithArgs(username).
+		WillReturnRows(rows)
+}
+
+func TestGetRolesByUsername_GroupRoles(t *testing.T) {
+	mock, cleanup := setupRoleMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "roles" WHERE (username = $1 AND (org = '' OR org = $2) AND (expires_at IS NULL OR expires_at > $3))`)).
+		WithArgs("testuser", "", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "deleted_at", "username", "role"}).
+			AddRow(1, nil, nil, nil, "testuser", "editor"))
+	expectGroupRoles(mock, "testuser", "eng", "editor", "eng", "deployer")
+	expectRoleInheritance(mock, "deployer", "viewer")
+
+	roles, err := GetRolesByUsername("testuser")
+	if err != nil {
+		t.Fatalf("GetRolesByUsername() error = %v", err)
+	}
+
+	if len(roles) != 3 {
+		t.Fatalf("GetRolesByUsername() = %+v, want 3 roles", roles)
+	}
+	// The direct grant wins over the same role through a group
+	if roles[0].Role != "editor" || roles[0].Group != "" {
+		t.Errorf("GetRolesByUsername()[0] = %+v, want direct editor", roles[0])
+	}
+	if roles[1].Role != "deployer" || roles[1].Group != "eng" {
+		t.Errorf("GetRolesByUsername()[1] = %+v, want deployer through eng", roles[1])
+	}
+	if roles[2].Role != "viewer" || roles[2].InheritedFrom != "deployer" {
+		t.Errorf("GetRolesByUsername()[2] = %+v, want viewer inherited from deployer", roles[2])
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// A re-registered username must not pick up the group roles of the deleted
+// account that used it before, whose memberships are only soft-deleted
+func TestRoleCheck_ReregisteredUsername(t *testing.T) {
+	mock, cleanup := setupRoleMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "roles" WHERE (username = $1 AND (org = '' OR org = $2) AND (expires_at IS NULL OR expires_at > $3))`)).
+		WithArgs("testuser", "", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "deleted_at", "username", "role"}))
+	expectGroupRoles(mock, "testuser")
+
+	isAdmin, err := RoleCheck(AdminRole, "testuser")
+	if err != nil {
+		t.Fatalf("RoleCheck() error = %v", err)
+	}
+	if isAdmin {
+		t.Error("RoleCheck() = true, want false for the deleted owner's group")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestAddGroupMember_GroupNotFound(t *testing.T) {
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "groups" WHERE name = $1`)).
+		WithArgs("eng", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+
+	err := AddGroupMember("eng", "testuser", "admin")
+	if !errors.Is(err, ErrGroupNotFound) {
+		t.Errorf("AddGroupMember() error = %v, want ErrGroupNotFound", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestRemoveGroupMember_EndsSession(t *testing.T) {
+	t.Setenv("TOKEN_EMBED", "roles")
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+	redisMock := setupMockRedis(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "group_members" WHERE group_name = $1 AND username = $2`)).
+		WithArgs("eng", "testuser").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	redisMock.ExpectDel("testuser-token").SetVal(1)
+
+	if err := RemoveGroupMember("eng", "testuser"); err != nil {
+		t.Errorf("RemoveGroupMember() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+	if err := redisMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled redis expectations: %v", err)
+	}
+}
+
+func TestRemoveGroupMember_NotMember(t *testing.T) {
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "group_members" WHERE group_name = $1 AND username = $2`)).
+		WithArgs("eng", "testuser").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	err := RemoveGroupMember("eng", "testuser")
+	if !errors.Is(err, ErrGroupMemberNotFound) {
+		t.Errorf("RemoveGroupMember() error = %v, want ErrGroupMemberNotFound", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestDeleteGroup(t *testing.T) {
+	t.Setenv("TOKEN_EMBED", "roles")
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+	redisMock := setupMockRedis(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "groups" WHERE name = $1`)).
+		WithArgs("eng").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`DELETE FROM "group_members" WHERE group_name = $1 RETURNING "username"`)).
+		WithArgs("eng").
+		WillReturnRows(sqlmock.NewRows([]string{"username"}).AddRow("alice").AddRow("bob"))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "group_roles" WHERE group_name = $1`)).
+		WithArgs("eng").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	redisMock.ExpectDel("alice-token", "bob-token").SetVal(2)
+
+	if err := DeleteGroup("eng"); err != nil {
+		t.Errorf("DeleteGroup() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+	if err := redisMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled redis expectations: %v", err)
+	}
+}
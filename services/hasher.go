@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrHashQueueFull is returned when the password hashing queue has no room
+// left for another job; callers should ask the client to retry later.
+var ErrHashQueueFull = errors.New("password hashing queue is full")
+
+var hashMetrics = expvar.NewMap("password_hashing")
+
+type hashJob struct {
+	ctx      context.Context
+	work     func()
+	enqueued time.Time
+	err      error
+	done     chan struct{}
+}
+
+type hashPool struct {
+	jobs chan *hashJob
+}
+
+var (
+	pool     *hashPool
+	poolOnce sync.Once
+)
+
+// getHashPool lazily starts the worker pool. HASH_WORKERS sets the number of
+// workers (defaults to the number of CPUs) and HASH_QUEUE_DEPTH the number of
+// jobs that may wait for a free worker (defaults to 64).
+func getHashPool() *hashPool {
+	poolOnce.Do(func() {
+		workers := envInt("HASH_WORKERS", runtime.NumCPU())
+		depth := envInt("HASH_QUEUE_DEPTH", 64)
+
+		pool = &hashPool{jobs: make(chan *hashJob, depth)}
+		for i := 0; i < workers; i++ {
+			go pool.worker()
+		}
+	})
+	return pool
+}
+
+func (p *hashPool) worker() {
+	for job := range p.jobs {
+		hashMetrics.Add("queued", -1)
+
+		wait := time.Since(job.enqueued)
+		hashMetrics.Add("queue_wait_count", 1)
+		hashMetrics.Add("queue_wait_ns_total", wait.Nanoseconds())
+
+		// Caller already gave up; don't burn a core on it
+		if job.ctx.Err() != nil {
+			hashMetrics.Add("cancelled", 1)
+			job.err = job.ctx.Err()
+			close(job.done)
+			continue
+		}
+
+		start := time.Now()
+		job.work()
+		hashMetrics.Add("hash_count", 1)
+		hashMetrics.Add("hash_ns_total", time.Since(start).Nanoseconds())
+
+		close(job.done)
+	}
+}
+
+// run queues work on the pool and blocks until it has finished or ctx is done.
+func (p *hashPool) run(ctx context.Context, work func()) error {
+	job := &hashJob{
+		ctx:      ctx,
+		work:     work,
+		enqueued: time.Now(),
+		done:     make(chan struct{}),
+	}
+
+	select {
+	case p.jobs <- job:
+		hashMetrics.Add("queued", 1)
+	default:
+		hashMetrics.Add("rejected", 1)
+		return ErrHashQueueFull
+	}
+
+	select {
+	case <-job.done:
+		return job.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func envInt(name string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestHashPool_RunsWork(t *testing.T) {
+	p := &hashPool{jobs: make(chan *hashJob, 1)}
+	go p.worker()
+	defer close(p.jobs)
+
+	ran := false
+	err := p.run(context.Background(), func() { ran = true })
+	if err != nil {
+		t.Errorf("run() error = %v", err)
+	}
+
+	if !ran {
+		t.Error("run() should execute the work")
+	}
+}
+
+func TestHashPool_QueueFull(t *testing.T) {
+	// No workers, so the single queue slot stays occupied
+	p := &hashPool{jobs: make(chan *hashJob, 1)}
+	p.jobs <- &hashJob{ctx: context.Background(), done: make(chan struct{})}
+
+	err := p.run(context.Background(), func() {})
+	if !errors.Is(err, ErrHashQueueFull) {
+		t.Errorf("run() error = %v, want %v", err, ErrHashQueueFull)
+	}
+}
+
+func TestHashPool_ContextCancelled(t *testing.T) {
+	p := &hashPool{jobs: make(chan *hashJob, 1)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := p.run(ctx, func() {})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("run() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestHashPool_SkipsCancelledJobs(t *testing.T) {
+	p := &hashPool{jobs: make(chan *hashJob, 1)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	ran := false
+	job := &hashJob{ctx: ctx, work: func() { ran = true }, done: make(chan struct{})}
+	p.jobs <- job
+	close(p.jobs)
+	p.worker()
+
+	if ran {
+		t.Error("worker() should not run work for a cancelled job")
+	}
+
+	if !errors.Is(job.err, context.Canceled) {
+		t.Errorf("worker() job error = %v, want %v", job.err, context.Canceled)
+	}
+}
+
+func TestCheckPasswordHashContext_Cancelled(t *testing.T) {
+	hash, err := HashPassword("password123")
+	if err != nil {
+		t.Fatalf("HashPassword() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	isMatch, err := CheckPasswordHashContext(ctx, "password123", hash)
+	if err == nil {
+		t.Error("CheckPasswordHashContext() should return error for cancelled context")
+	}
+
+	if isMatch {
+		t.Error("CheckPasswordHashContext() should return false for cancelled context")
+	}
+}
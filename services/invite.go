@@ -0,0 +1,118 @@
+package services
+
+import (
+	"auth-api-go/models"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrInviteInvalid = errors.New("invite code is invalid, expired or used up")
+
+func hashInviteCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateInvite makes an invite that can be redeemed maxUses times (0 means
+// unlimited) until expiresIn has passed (0 means never), granting roles to
+// each user who redeems it. Roles must be in the catalog. The code is only
+// returned here.
+func CreateInvite(createdBy string, maxUses int, expiresIn time.Duration, roles []string) (string, *models.Invite, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", nil, fmt.Errorf("error generating invite code: %v", err)
+	}
+	code := hex.EncodeToString(raw)
+
+	var cleanRoles []string
+	for _, role := range roles {
+		if role = strings.TrimSpace(role); role != "" {
+			if _, err := GetRoleDefinition(role); err != nil {
+				return "", nil, err
+			}
+			cleanRoles = append(cleanRoles, role)
+		}
+	}
+
+	inviteEntry := &models.Invite{
+		CodeHash:  hashInviteCode(code),
+		CreatedBy: createdBy,
+		MaxUses:   maxUses,
+		Roles:     strings.Join(cleanRoles, ","),
+	}
+	if expiresIn > 0 {
+		expiresAt := time.Now().Add(expiresIn)
+		inviteEntry.ExpiresAt = &expiresAt
+	}
+
+	err := models.DB.Create(inviteEntry).Error
+	if err != nil {
+		return "", nil, err
+	}
+
+	return code, inviteEntry, nil
+}
+
+func GetInvites() ([]models.Invite, error) {
+	var invites []models.Invite
+	result := models.DB.Order("created_at desc").Find(&invites)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return invites, nil
+}
+
+func DeleteInvite(id uint) error {
+	result := models.DB.Delete(&models.Invite{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// redeemInvite uses up one use of the invite for code inside tx, locking the
+// row so concurrent registrations can't exceed MaxUses.
+func redeemInvite(tx *gorm.DB, code string) (*models.Invite, error) {
+	var invite models.Invite
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("code_hash = ?", hashInviteCode(code)).First(&invite).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInviteInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if invite.ExpiresAt != nil && time.Now().After(*invite.ExpiresAt) {
+		return nil, ErrInviteInvalid
+	}
+	if invite.MaxUses > 0 && invite.Uses >= invite.MaxUses {
+		return nil, ErrInviteInvalid
+	}
+
+	err = tx.Model(&invite).Update("uses", gorm.Expr("uses + 1")).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &invite, nil
+}
+
+// InviteRoles returns the roles an invite grants
+func InviteRoles(invite *models.Invite) []string {
+	if invite.Roles == "" {
+		return nil
+	}
+	return strings.Split(invite.Roles, ",")
+}
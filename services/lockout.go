@@ -0,0 +1,210 @@
+package services
+
+import (
+	"auth-api-go/redis"
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+type lockoutConfig struct {
+	window        time.Duration
+	userThreshold int64
+	ipThreshold   int64
+	lockout       time.Duration
+	delayAfter    int64
+	delayBase     time.Duration
+	delayMax      time.Duration
+}
+
+func loadLockoutConfig() lockoutConfig {
+	return lockoutConfig{
+		window:        time.Duration(envInt("LOGIN_FAILURE_WINDOW_MINUTES", 15)) * time.Minute,
+		userThreshold: int64(envInt("LOGIN_LOCKOUT_THRESHOLD", 10)),
+		ipThreshold:   int64(envInt("LOGIN_IP_LOCKOUT_THRESHOLD", 50)),
+		lockout:       time.Duration(envInt("LOGIN_LOCKOUT_MINUTES", 15)) * time.Minute,
+		delayAfter:    int64(envInt("LOGIN_DELAY_AFTER", 3)),
+		delayBase:     time.Duration(envInt("LOGIN_DELAY_BASE_SECONDS", 1)) * time.Second,
+		delayMax:      time.Duration(envInt("LOGIN_DELAY_MAX_SECONDS", 60)) * time.Second,
+	}
+}
+
+// Failed logins are tracked separately per username and per client IP, so
+// spraying one password across many usernames is throttled too. The prefixes
+// differ so no username can collide with an IP's counters.
+func userThrottleKey(username string) string {
+	return "login:user:" + username
+}
+
+func ipThrottleKey(ip string) string {
+	return "login:ip:" + ip
+}
+
+// lockedUsersKey is a sorted set of locked-out usernames, scored by the unix
+// millisecond their lockout ends, so they can be listed without a SCAN
+const lockedUsersKey = "login:locked-users"
+
+// CheckLoginAllowed returns how long the caller must wait before another
+// login attempt for username from ip; zero means go ahead. Lockouts and
+// back-off delays are stored as the unix millisecond they end at.
+func CheckLoginAllowed(username string, ip string) (time.Duration, error) {
+	ctx := context.Background()
+
+	keys := []string{
+		userThrottleKey(username) + "-lock",
+		userThrottleKey(username) + "-delay",
+		ipThrottleKey(ip) + "-lock",
+		ipThrottleKey(ip) + "-delay",
+	}
+	values, err := redis.REDIS.MGet(ctx, keys...).Result()
+	if err != nil {
+		fmt.Println("error with redis mget", err.Error())
+		return 0, fmt.Errorf("error with redis mget: %v", err)
+	}
+
+	var wait time.Duration
+	for _, value := range values {
+		text, ok := value.(string)
+		if !ok {
+			continue
+		}
+		until, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			continue
+		}
+		if remaining := time.Until(time.UnixMilli(until)); remaining > wait {
+			wait = remaining
+		}
+	}
+
+	return wait, nil
+}
+
+// RecordLoginFailure counts a failed login for username and ip, applying an
+// exponential back-off once LOGIN_DELAY_AFTER failures are reached and a
+// lockout at the thresholds. It is called for unknown usernames too, so
+// lockouts don't reveal whether an account exists.
+func RecordLoginFailure(username string, ip string) error {
+	config := loadLockoutConfig()
+
+	err := recordFailure(userThrottleKey(username), config.userThreshold, config, func(until time.Time) error {
+		ctx := context.Background()
+		err := redis.REDIS.ZAdd(ctx, lockedUsersKey, goredis.Z{Score: float64(until.UnixMilli()), Member: username}).Err()
+		if err != nil {
+			fmt.Println("error with redis zadd", err.Error())
+			return fmt.Errorf("error with redis zadd: %v", err)
+		}
+		return RecordAuditEvent(AuditLoginLockout, username, "", ip, "too many failed logins for username")
+	})
+	if err != nil {
+		return err
+	}
+
+	return recordFailure(ipThrottleKey(ip), config.ipThreshold, config, func(until time.Time) error {
+		return RecordAuditEvent(AuditLoginLockout, username, "", ip, "too many failed logins from ip")
+	})
+}
+
+func recordFailure(key string, threshold int64, config lockoutConfig, onLockout func(until time.Time) error) error {
+	ctx := context.Background()
+
+	failures, err := redis.REDIS.Incr(ctx, key+"-failures").Result()
+	if err != nil {
+		fmt.Println("error with redis incr", err.Error())
+		return fmt.Errorf("error with redis incr: %v", err)
+	}
+	err = redis.REDIS.Expire(ctx, key+"-failures", config.window).Err()
+	if err != nil {
+		fmt.Println("error with redis expire", err.Error())
+		return fmt.Errorf("error with redis expire: %v", err)
+	}
+
+	if failures >= threshold {
+		until := time.Now().Add(config.lockout)
+		err = redis.REDIS.Set(ctx, key+"-lock", until.UnixMilli(), config.lockout).Err()
+		if err != nil {
+			fmt.Println("error with redis set", err.Error())
+			return fmt.Errorf("error with redis set: %v", err)
+		}
+
+		// Start counting afresh once the lockout ends
+		err = redis.REDIS.Del(ctx, key+"-failures").Err()
+		if err != nil {
+			fmt.Println("error with redis del", err.Error())
+			return fmt.Errorf("error with redis del: %v", err)
+		}
+
+		return onLockout(until)
+	}
+
+	if failures >= config.delayAfter {
+		delay := loginDelay(failures-config.delayAfter, config)
+		until := time.Now().Add(delay)
+		err = redis.REDIS.Set(ctx, key+"-delay", until.UnixMilli(), delay).Err()
+		if err != nil {
+			fmt.Println("error with redis set", err.Error())
+			return fmt.Errorf("error with redis set: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// loginDelay doubles the base delay for every failure past the first delayed one
+func loginDelay(step int64, config lockoutConfig) time.Duration {
+	delay := config.delayBase
+	for i := int64(0); i < step && delay < config.delayMax; i++ {
+		delay *= 2
+	}
+	if delay > config.delayMax {
+		delay = config.delayMax
+	}
+	return delay
+}
+
+// RecordLoginSuccess clears the username's failure count. The IP's count is
+// left alone so one good login can't reset a spraying attack.
+func RecordLoginSuccess(username string) error {
+	ctx := context.Background()
+	err := redis.REDIS.Del(ctx, userThrottleKey(username)+"-failures", userThrottleKey(username)+"-delay").Err()
+	if err != nil {
+		fmt.Println("error with redis del", err.Error())
+		return fmt.Errorf("error with redis del: %v", err)
+	}
+	return nil
+}
+
+// GetLoginFailureCount returns the number of recent failed logins for username
+func GetLoginFailureCount(username string) (int64, error) {
+	ctx := context.Background()
+	val, err := redis.REDIS.Get(ctx, userThrottleKey(username)+"-failures").Result()
+	if err != nil {
+		if err.Error() == "redis: nil" {
+			return 0, nil
+		}
+		fmt.Println("error with redis get", err.Error())
+		return 0, fmt.Errorf("error with redis get: %v", err)
+	}
+	return strconv.ParseInt(val, 10, 64)
+}
+
+// UnlockAccount lifts any lockout or back-off on username and records who did it
+func UnlockAccount(username string, actor string, ip string) error {
+	ctx := context.Background()
+	key := userThrottleKey(username)
+	err := redis.REDIS.Del(ctx, key+"-failures", key+"-delay", key+"-lock").Err()
+	if err != nil {
+		fmt.Println("error with redis del", err.Error())
+		return fmt.Errorf("error with redis del: %v", err)
+	}
+	err = redis.REDIS.ZRem(ctx, lockedUsersKey, username).Err()
+	if err != nil {
+		fmt.Println("error with redis zrem", err.Error())
+		return fmt.Errorf("error with redis zrem: %v", err)
+	}
+
+	return RecordAuditEvent(AuditAccountUnlock, username, actor, ip, "")
+}
@@ -0,0 +1,202 @@
+package services
+
+import (
+	"auth-api-go/redis"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-redis/redismock/v9"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+func setupMockRedis(t *testing.T) redismock.ClientMock {
+	db, mock := redismock.NewClientMock()
+	originalRedis := redis.REDIS
+	redis.REDIS = db
+	t.Cleanup(func() {
+		redis.REDIS = originalRedis
+	})
+	return mock
+}
+
+func TestCheckLoginAllowed_NoThrottle(t *testing.T) {
+	mock := setupMockRedis(t)
+
+	mock.ExpectMGet("login:user:testuser-lock", "login:user:testuser-delay", "login:ip:10.0.0.1-lock", "login:ip:10.0.0.1-delay").
+		SetVal([]interface{}{nil, nil, nil, nil})
+
+	wait, err := CheckLoginAllowed("testuser", "10.0.0.1")
+	if err != nil {
+		t.Errorf("CheckLoginAllowed() error = %v", err)
+	}
+
+	if wait != 0 {
+		t.Errorf("CheckLoginAllowed() wait = %v, want 0", wait)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestCheckLoginAllowed_Locked(t *testing.T) {
+	mock := setupMockRedis(t)
+
+	lockedUntil := strconv.FormatInt(time.Now().Add(10*time.Minute).UnixMilli(), 10)
+	delayedUntil := strconv.FormatInt(time.Now().Add(5*time.Second).UnixMilli(), 10)
+
+	mock.ExpectMGet("login:user:testuser-lock", "login:user:testuser-delay", "login:ip:10.0.0.1-lock", "login:ip:10.0.0.1-delay").
+		SetVal([]interface{}{nil, delayedUntil, lockedUntil, nil})
+
+	wait, err := CheckLoginAllowed("testuser", "10.0.0.1")
+	if err != nil {
+		t.Errorf("CheckLoginAllowed() error = %v", err)
+	}
+
+	if wait < 9*time.Minute {
+		t.Errorf("CheckLoginAllowed() wait = %v, want the longest remaining lockout", wait)
+	}
+}
+
+func TestRecordLoginFailure_BelowThresholds(t *testing.T) {
+	mock := setupMockRedis(t)
+
+	mock.ExpectIncr("login:user:testuser-failures").SetVal(1)
+	mock.ExpectExpire("login:user:testuser-failures", 15*time.Minute).SetVal(true)
+	mock.ExpectIncr("login:ip:10.0.0.1-failures").SetVal(1)
+	mock.ExpectExpire("login:ip:10.0.0.1-failures", 15*time.Minute).SetVal(true)
+
+	err := RecordLoginFailure("testuser", "10.0.0.1")
+	if err != nil {
+		t.Errorf("RecordLoginFailure() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestRecordLoginFailure_Delay(t *testing.T) {
+	mock := setupMockRedis(t)
+
+	mock.ExpectIncr("login:user:testuser-failures").SetVal(4)
+	mock.ExpectExpire("login:user:testuser-failures", 15*time.Minute).SetVal(true)
+	mock.Regexp().ExpectSet("login:user:testuser-delay", `^\d+$`, 2*time.Second).SetVal("OK")
+	mock.ExpectIncr("login:ip:10.0.0.1-failures").SetVal(1)
+	mock.ExpectExpire("login:ip:10.0.0.1-failures", 15*time.Minute).SetVal(true)
+
+	err := RecordLoginFailure("testuser", "10.0.0.1")
+	if err != nil {
+		t.Errorf("RecordLoginFailure() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestRecordLoginFailure_Lockout(t *testing.T) {
+	t.Setenv("LOGIN_LOCKOUT_THRESHOLD", "5")
+
+	mock := setupMockRedis(t)
+	dbMock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	mock.ExpectIncr("login:user:testuser-failures").SetVal(5)
+	mock.ExpectExpire("login:user:testuser-failures", 15*time.Minute).SetVal(true)
+	mock.Regexp().ExpectSet("login:user:testuser-lock", `^\d+$`, 15*time.Minute).SetVal("OK")
+	mock.ExpectDel("login:user:testuser-failures").SetVal(1)
+	// The score is the lockout's end, which depends on the clock
+	mock.CustomMatch(func(expected, actual []interface{}) error {
+		if actual[0] != "zadd" || actual[1] != "login:locked-users" || actual[len(actual)-1] != "testuser" {
+			return fmt.Errorf("unexpected command %v", actual)
+		}
+		return nil
+	}).ExpectZAdd("login:locked-users", goredis.Z{Member: "testuser"}).SetVal(1)
+	mock.ExpectIncr("login:ip:10.0.0.1-failures").SetVal(1)
+	mock.ExpectExpire("login:ip:10.0.0.1-failures", 15*time.Minute).SetVal(true)
+
+	dbMock.ExpectBegin()
+	dbMock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "audit_events"`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), AuditLoginLockout, "testuser", "", "10.0.0.1", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	dbMock.ExpectCommit()
+
+	err := RecordLoginFailure("testuser", "10.0.0.1")
+	if err != nil {
+		t.Errorf("RecordLoginFailure() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+
+	if err := dbMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestLoginDelay(t *testing.T) {
+	config := lockoutConfig{delayBase: time.Second, delayMax: 60 * time.Second}
+
+	tests := []struct {
+		step int64
+		want time.Duration
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{3, 8 * time.Second},
+		{10, 60 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := loginDelay(tt.step, config); got != tt.want {
+			t.Errorf("loginDelay(%d) = %v, want %v", tt.step, got, tt.want)
+		}
+	}
+}
+
+func TestGetLoginFailureCount(t *testing.T) {
+	mock := setupMockRedis(t)
+
+	mock.ExpectGet("login:user:testuser-failures").SetVal("3")
+	mock.ExpectGet("login:user:otheruser-failures").RedisNil()
+
+	count, err := GetLoginFailureCount("testuser")
+	if err != nil || count != 3 {
+		t.Errorf("GetLoginFailureCount() = %v, %v, want 3", count, err)
+	}
+
+	count, err = GetLoginFailureCount("otheruser")
+	if err != nil || count != 0 {
+		t.Errorf("GetLoginFailureCount() = %v, %v, want 0", count, err)
+	}
+}
+
+func TestUnlockAccount(t *testing.T) {
+	mock := setupMockRedis(t)
+	dbMock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	mock.ExpectDel("login:user:testuser-failures", "login:user:testuser-delay", "login:user:testuser-lock").SetVal(1)
+	mock.ExpectZRem("login:locked-users", "testuser").SetVal(1)
+
+	dbMock.ExpectBegin()
+	dbMock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "audit_events"`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), AuditAccountUnlock, "testuser", "app:billing", "10.0.0.1", "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	dbMock.ExpectCommit()
+
+	err := UnlockAccount("testuser", "app:billing", "10.0.0.1")
+	if err != nil {
+		t.Errorf("UnlockAccount() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
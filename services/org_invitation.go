@@ -0,0 +1,185 @@
+package services
+
+import (
+	"auth-api-go/models"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrOrgInvitationInvalid   = errors.New("invitation is invalid, expired or already accepted")
+	ErrOrgInvitationEmail     = errors.New("invitation is for another email address")
+	ErrOrgInvitationNotFound  = errors.New("invitation not found")
+	ErrOrgInvitationEmailless = errors.New("an email address is required")
+	ErrOrgInvitationRole      = errors.New("only assignable roles can be granted through an invitation")
+)
+
+// orgInvitationTTL reads ORG_INVITE_TTL_HOURS, how long invitations last by default
+func orgInvitationTTL() time.Duration {
+	return time.Duration(envInt("ORG_INVITE_TTL_HOURS", 168)) * time.Hour
+}
+
+// CreateOrgInvitation invites email to join org as role, granting roles in
+// org on acceptance. Roles must be in the catalog and assignable, since org
+// admins hand them out without a deployment admin. expiresIn of 0 uses
+// ORG_INVITE_TTL_HOURS. The token is only returned here; delivering it to
+// the invitee is up to the caller.
+func CreateOrgInvitation(org string, email string, role string, roles []string, invitedBy string, expiresIn time.Duration) (string, *models.OrgInvitation, error) {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return "", nil, ErrOrgInvitationEmailless
+	}
+	if role == "" {
+		role = OrgRoleMember
+	}
+	if err := validateOrgRole(role); err != nil {
+		return "", nil, err
+	}
+
+	var cleanRoles []string
+	for _, catalogRole := range roles {
+		if catalogRole = strings.TrimSpace(catalogRole); catalogRole != "" {
+			isAssignable, err := IsRoleSelfAssignable(catalogRole)
+			if err != nil {
+				return "", nil, err
+			}
+			if !isAssignable {
+				return "", nil, ErrOrgInvitationRole
+			}
+			cleanRoles = append(cleanRoles, catalogRole)
+		}
+	}
+
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", nil, fmt.Errorf("error generating invitation token: %v", err)
+	}
+	token := hex.EncodeToString(raw)
+
+	if expiresIn <= 0 {
+		expiresIn = orgInvitationTTL()
+	}
+
+	invitationEntry := &models.OrgInvitation{
+		Org:       org,
+		Email:     email,
+		TokenHash: hashInviteCode(token),
+		Role:      role,
+		Roles:     strings.Join(cleanRoles, ","),
+		InvitedBy: invitedBy,
+		ExpiresAt: time.Now().Add(expiresIn),
+	}
+
+	err := models.DB.Create(invitationEntry).Error
+	if err != nil {
+		return "", nil, err
+	}
+
+	return token, invitationEntry, nil
+}
+
+// GetOrgInvitations returns the invitations to org nobody has accepted yet
+func GetOrgInvitations(org string) ([]models.OrgInvitation, error) {
+	var invitations []models.OrgInvitation
+	result := models.DB.Order("created_at desc").Find(&invitations, "org = ? AND accepted_at IS NULL", org)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return invitations, nil
+}
+
+func RevokeOrgInvitation(org string, id uint) error {
+	result := models.DB.Where("org = ? AND accepted_at IS NULL", org).Delete(&models.OrgInvitation{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrOrgInvitationNotFound
+	}
+	return nil
+}
+
+// GetOrgInvitation returns the pending invitation for token
+func GetOrgInvitation(token string) (*models.OrgInvitation, error) {
+	var invitation models.OrgInvitation
+	err := models.DB.Where("token_hash = ?", hashInviteCode(token)).First(&invitation).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrOrgInvitationInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if invitation.AcceptedAt != nil || time.Now().After(invitation.ExpiresAt) {
+		return nil, ErrOrgInvitationInvalid
+	}
+	return &invitation, nil
+}
+
+// acceptOrgInvitation uses up the invitation for token inside tx: username,
+// whose address is email, joins the org with the invited role and roles. The
+// row is locked so an invitation can only be accepted once.
+func acceptOrgInvitation(tx *gorm.DB, token string, username string, email string) (*models.OrgInvitation, error) {
+	var invitation models.OrgInvitation
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("token_hash = ?", hashInviteCode(token)).First(&invitation).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrOrgInvitationInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if invitation.AcceptedAt != nil || time.Now().After(invitation.ExpiresAt) {
+		return nil, ErrOrgInvitationInvalid
+	}
+	if !strings.EqualFold(invitation.Email, email) {
+		return nil, ErrOrgInvitationEmail
+	}
+
+	err = insertOrgMember(tx, invitation.Org, username, invitation.Role, invitation.InvitedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, role := range InviteRoles(&models.Invite{Roles: invitation.Roles}) {
+		err = tx.Create(&models.Roles{Username: username, Role: role, Org: invitation.Org, GrantedBy: invitation.InvitedBy}).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	err = tx.Model(&invitation).Updates(models.OrgInvitation{AcceptedBy: username, AcceptedAt: &now}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &invitation, nil
+}
+
+// AcceptOrgInvitation lets an existing user accept the invitation for token.
+// Their email address has to match the one invited.
+func AcceptOrgInvitation(token string, username string) (*models.OrgInvitation, error) {
+	user, err := GetUserByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+
+	var invitation *models.OrgInvitation
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		invitation, err = acceptOrgInvitation(tx, token, user.Username, user.Email)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return invitation, rolesChanged(username)
+}
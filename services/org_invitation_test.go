@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var orgInvitationColumns = []string{"id", "org", "email", "token_hash", "role", "roles", "invited_by", "expires_at", "accepted_at"}
+
+func expectOrgInvitation(mock sqlmock.Sqlmock, query string, expiresAt time.Time) {
+	rows := sqlmock.NewRows(orgInvitationColumns).
+		AddRow(3, "acme", "Invitee@Example.com", hashInviteCode("invitetoken"), OrgRoleAdmin, "editor", "owner", expiresAt, nil)
+	mock.ExpectQuery(regexp.QuoteMeta(query)).
+		WithArgs(hashInviteCode("invitetoken"), 1).
+		WillReturnRows(rows)
+}
+
+func TestRegisterUser_WithOrgInvitation(t *testing.T) {
+	t.Setenv("REGISTRATION_MODE", RegistrationInviteOnly)
+
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	expectOrgInvitation(mock, `SELECT * FROM "org_invitations" WHERE token_hash = $1 AND "org_invitations"."deleted_at" IS NULL ORDER BY "org_invitations"."id" LIMIT $2`, time.Now().Add(time.Hour))
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "users"`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "testuser", sqlmock.AnyArg(), sqlmock.AnyArg(), "Invitee@Example.com", nil, "", UserActive, "", nil, "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	expectOrgInvitation(mock, `SELECT * FROM "org_invitations" WHERE token_hash = $1 AND "org_invitations"."deleted_at" IS NULL ORDER BY "org_invitations"."id" LIMIT $2 FOR UPDATE`, time.Now().Add(time.Hour))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "org_members"`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "acme", "testuser", OrgRoleAdmin, "owner").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "roles"`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "testuser", "editor", "acme", nil, "owner").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "org_invitations" SET`)).
+		WithArgs(sqlmock.AnyArg(), "testuser", sqlmock.AnyArg(), 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	user, err := RegisterUser(context.Background(), Registration{Username: "testuser", Password: "password123", OrgInvitation: "invitetoken"})
+	if err != nil {
+		t.Fatalf("RegisterUser() error = %v", err)
+	}
+
+	if user.Email != "Invitee@Example.com" {
+		t.Errorf("RegisterUser() email = %v, want the invited address", user.Email)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestRegisterUser_OrgInvitationEmailMismatch(t *testing.T) {
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	expectOrgInvitation(mock, `SELECT * FROM "org_invitations" WHERE token_hash = $1`, time.Now().Add(time.Hour))
+
+	_, err := RegisterUser(context.Background(), Registration{Username: "testuser", Password: "password123", Email: "other@example.com", OrgInvitation: "invitetoken"})
+	if !errors.Is(err, ErrOrgInvitationEmail) {
+		t.Errorf("RegisterUser() error = %v, want %v", err, ErrOrgInvitationEmail)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestAcceptOrgInvitation_Expired(t *testing.T) {
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE username = $1`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "email"}).AddRow(1, "testuser", "invitee@example.com"))
+	mock.ExpectBegin()
+	expectOrgInvitation(mock, `SELECT * FROM "org_invitations" WHERE token_hash = $1`, time.Now().Add(-time.Hour))
+	mock.ExpectRollback()
+
+	_, err := AcceptOrgInvitation("invitetoken", "testuser")
+	if !errors.Is(err, ErrOrgInvitationInvalid) {
+		t.Errorf("AcceptOrgInvitation() error = %v, want %v", err, ErrOrgInvitationInvalid)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestCreateOrgInvitation_InvalidRole(t *testing.T) {
+	_, _, err := CreateOrgInvitation("acme", "invitee@example.com", "owner", nil, "owner", 0)
+	if !errors.Is(err, ErrOrgRoleInvalid) {
+		t.Errorf("CreateOrgInvitation() error = %v, want %v", err, ErrOrgRoleInvalid)
+	}
+}
+
+func TestCreateOrgInvitation_RoleNotAssignable(t *testing.T) {
+	mock, cleanup := setupRoleMockDB(t)
+	defer cleanup()
+
+	expectRoleDefinition(mock, "billing-admin", false)
+
+	_, _, err := CreateOrgInvitation("acme", "invitee@example.com", OrgRoleMember, []string{"billing-admin"}, "owner", 0)
+	if !errors.Is(err, ErrOrgInvitationRole) {
+		t.Errorf("CreateOrgInvitation() error = %v, want %v", err, ErrOrgInvitationRole)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,295 @@
+package services
+
+import (
+	"auth-api-go/models"
+	"auth-api-go/redis"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/golang-jwt/jwt"
+	"gorm.io/gorm"
+)
+
+// Org member roles
+const (
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+var (
+	ErrOrgRoleInvalid    = errors.New("org member role must be admin or member")
+	ErrLastOrgAdmin      = errors.New("an organization needs at least one admin")
+	ErrOrgInvalid        = errors.New("organization slugs may only use lower case letters, digits and hyphens")
+	ErrOrgExists         = errors.New("organization already exists")
+	ErrOrgNotFound       = errors.New("organization not found")
+	ErrOrgMismatch       = errors.New("host and header name different organizations")
+	ErrNotOrgMember      = errors.New("user is not a member of the organization")
+	ErrOrgMemberExists   = errors.New("user is already a member of the organization")
+	ErrOrgMemberNotFound = errors.New("user is not a member of the organization")
+)
+
+var orgSlugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+func GetOrganizations() ([]models.Organization, error) {
+	var orgs []models.Organization
+	result := models.DB.Order("slug").Find(&orgs)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return orgs, nil
+}
+
+// GetOrganization returns ErrOrgNotFound when there is no org called slug
+func GetOrganization(slug string) (*models.Organization, error) {
+	var org models.Organization
+	err := models.DB.Where("slug = ?", slug).First(&org).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrOrgNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+func CreateOrganization(slug string, name string, domain string, createdBy string) (*models.Organization, error) {
+	if !orgSlugPattern.MatchString(slug) {
+		return nil, ErrOrgInvalid
+	}
+
+	orgEntry := &models.Organization{
+		Slug:      slug,
+		Name:      name,
+		Domain:    strings.ToLower(domain),
+		CreatedBy: createdBy,
+	}
+
+	err := models.DB.Create(orgEntry).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return nil, ErrOrgExists
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return orgEntry, nil
+}
+
+// ResolveOrg finds the organization a request is for, first from its host,
+// as an organization's Domain or "<slug>.<TENANT_BASE_DOMAIN>", then from the
+// X-Org header. It returns "" when neither names one.
+func ResolveOrg(host string, header string) (string, error) {
+	hostOrg, err := orgFromHost(host)
+	if err != nil {
+		return "", err
+	}
+
+	if header == "" {
+		return hostOrg, nil
+	}
+	if hostOrg != "" && hostOrg != header {
+		return "", ErrOrgMismatch
+	}
+
+	org, err := GetOrganization(header)
+	if err != nil {
+		return "", err
+	}
+	return org.Slug, nil
+}
+
+func orgFromHost(host string) (string, error) {
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	host = strings.ToLower(host)
+	if host == "" {
+		return "", nil
+	}
+
+	baseDomain := strings.ToLower(os.Getenv("TENANT_BASE_DOMAIN"))
+	if baseDomain != "" && strings.HasSuffix(host, "."+baseDomain) {
+		org, err := GetOrganization(strings.TrimSuffix(host, "."+baseDomain))
+		if err != nil {
+			return "", err
+		}
+		return org.Slug, nil
+	}
+
+	var slugs []string
+	result := models.DB.Model(&models.Organization{}).Where("domain = ?", host).Limit(1).Pluck("slug", &slugs)
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if len(slugs) == 0 {
+		return "", nil
+	}
+	return slugs[0], nil
+}
+
+// TokenOrg returns the org claim of a session token without verifying it.
+// It is only good for routing; ParseToken still has to check the token.
+func TokenOrg(tokenString string) string {
+	claims := &Claims{}
+	_, _, err := new(jwt.Parser).ParseUnverified(tokenString, claims)
+	if err != nil {
+		return ""
+	}
+	return claims.Org
+}
+
+// GetOrgMember returns ErrOrgMemberNotFound when username isn't in org
+func GetOrgMember(org string, username string) (*models.OrgMember, error) {
+	var member models.OrgMember
+	err := models.DB.Where("org = ? AND username = ?", org, username).First(&member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrOrgMemberNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+func IsOrgMember(org string, username string) (bool, error) {
+	var count int64
+	err := models.DB.Model(&models.OrgMember{}).Where("org = ? AND username = ?", org, username).Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func GetOrgMembers(org string) ([]models.OrgMember, error) {
+	var members []models.OrgMember
+	result := models.DB.Order("username").Find(&members, "org = ?", org)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return members, nil
+}
+
+func validateOrgRole(role string) error {
+	if role != OrgRoleAdmin && role != OrgRoleMember {
+		return ErrOrgRoleInvalid
+	}
+	return nil
+}
+
+// AddOrgMember adds username to org as role, a member when role is empty
+func AddOrgMember(org string, username string, role string, addedBy string) error {
+	if role == "" {
+		role = OrgRoleMember
+	}
+	if err := validateOrgRole(role); err != nil {
+		return err
+	}
+	if _, err := GetOrganization(org); err != nil {
+		return err
+	}
+
+	return insertOrgMember(models.DB, org, username, role, addedBy)
+}
+
+// insertOrgMember saves a membership using db, which may be a transaction
+func insertOrgMember(db *gorm.DB, org string, username string, role string, addedBy string) error {
+	memberEntry := &models.OrgMember{
+		Org:      org,
+		Username: username,
+		Role:     role,
+		AddedBy:  addedBy,
+	}
+
+	err := db.Create(memberEntry).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrOrgMemberExists
+	}
+	return err
+}
+
+// checkNotLastOrgAdmin refuses to take away the only admin of org
+func checkNotLastOrgAdmin(tx *gorm.DB, org string, username string) error {
+	var admins []string
+	err := tx.Model(&models.OrgMember{}).Where("org = ? AND role = ?", org, OrgRoleAdmin).Pluck("username", &admins).Error
+	if err != nil {
+		return err
+	}
+	if len(admins) == 1 && admins[0] == username {
+		return ErrLastOrgAdmin
+	}
+	return nil
+}
+
+// ChangeOrgMemberRole makes username an admin or a plain member of org
+func ChangeOrgMemberRole(org string, username string, role string) error {
+	if err := validateOrgRole(role); err != nil {
+		return err
+	}
+
+	return models.DB.Transaction(func(tx *gorm.DB) error {
+		if role != OrgRoleAdmin {
+			if err := checkNotLastOrgAdmin(tx, org, username); err != nil {
+				return err
+			}
+		}
+
+		result := tx.Model(&models.OrgMember{}).Where("org = ? AND username = ?", org, username).Update("role", role)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrOrgMemberNotFound
+		}
+		return nil
+	})
+}
+
+// RemoveOrgMember takes username out of org along with the roles they held
+// in it, and ends their session if it was for org. The last admin can't be
+// removed.
+func RemoveOrgMember(org string, username string) error {
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := checkNotLastOrgAdmin(tx, org, username); err != nil {
+			return err
+		}
+
+		result := tx.Unscoped().Where("org = ? AND username = ?", org, username).Delete(&models.OrgMember{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrOrgMemberNotFound
+		}
+
+		return tx.Where("username = ? AND org = ?", username, org).Delete(&models.Roles{}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	return endOrgSession(username, org)
+}
+
+// endOrgSession deletes username's session if its token was issued for org
+func endOrgSession(username string, org string) error {
+	ctx := context.Background()
+	val, err := redis.REDIS.Get(ctx, username+"-token").Result()
+	if err != nil {
+		if err.Error() == "redis: nil" {
+			return nil
+		}
+		fmt.Println("error with redis get", err.Error())
+		return fmt.Errorf("error with redis get: %v", err)
+	}
+
+	if TokenOrg(val) != org {
+		return nil
+	}
+	_, err = DeleteSessionInRedis(username)
+	return err
+}
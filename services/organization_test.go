@@ -0,0 +1,246 @@
+package services
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang-jwt/jwt"
+)
+
+var organizationColumns = []string{"id", "created_at", "updated_at", "deleted_at", "slug", "name", "domain", "created_by"}
+
+func TestResolveOrg_BaseDomain(t *testing.T) {
+	t.Setenv("TENANT_BASE_DOMAIN", "example.com")
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "organizations" WHERE slug = $1`)).
+		WithArgs("acme", 1).
+		WillReturnRows(sqlmock.NewRows(organizationColumns).AddRow(1, nil, nil, nil, "acme", "Acme", "", "admin"))
+
+	org, err := ResolveOrg("acme.example.com:8080", "")
+	if err != nil {
+		t.Fatalf("ResolveOrg() error = %v", err)
+	}
+	if org != "acme" {
+		t.Errorf("ResolveOrg() = %q, want acme", org)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestResolveOrg_Domain(t *testing.T) {
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "slug" FROM "organizations" WHERE domain = $1`)).
+		WithArgs("auth.acme.test", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"slug"}).AddRow("acme"))
+
+	org, err := ResolveOrg("Auth.Acme.test", "")
+	if err != nil {
+		t.Fatalf("ResolveOrg() error = %v", err)
+	}
+	if org != "acme" {
+		t.Errorf("ResolveOrg() = %q, want acme", org)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestResolveOrg_Mismatch(t *testing.T) {
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "slug" FROM "organizations" WHERE domain = $1`)).
+		WithArgs("auth.acme.test", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"slug"}).AddRow("acme"))
+
+	_, err := ResolveOrg("auth.acme.test", "globex")
+	if !errors.Is(err, ErrOrgMismatch) {
+		t.Errorf("ResolveOrg() error = %v, want ErrOrgMismatch", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestResolveOrg_UnknownHeader(t *testing.T) {
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "slug" FROM "organizations" WHERE domain = $1`)).
+		WithArgs("localhost", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"slug"}))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "organizations" WHERE slug = $1`)).
+		WithArgs("globex", 1).
+		WillReturnRows(sqlmock.NewRows(organizationColumns))
+
+	_, err := ResolveOrg("localhost:8080", "globex")
+	if !errors.Is(err, ErrOrgNotFound) {
+		t.Errorf("ResolveOrg() error = %v, want ErrOrgNotFound", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestTokenOrg(t *testing.T) {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{Username: "testuser", Org: "acme"}).
+		SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatalf("SignedString() error = %v", err)
+	}
+
+	if got := TokenOrg(token); got != "acme" {
+		t.Errorf("TokenOrg() = %q, want acme", got)
+	}
+	if got := TokenOrg("not-a-token"); got != "" {
+		t.Errorf("TokenOrg() = %q, want empty", got)
+	}
+}
+
+func TestGetOrgRolesByUsername(t *testing.T) {
+	mock, cleanup := setupRoleMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "roles" WHERE (username = $1 AND (org = '' OR org = $2) AND (expires_at IS NULL OR expires_at > $3))`)).
+		WithArgs("testuser", "acme", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "deleted_at", "username", "role", "org"}).
+			AddRow(1, nil, nil, nil, "testuser", "viewer", "").
+			AddRow(2, nil, nil, nil, "testuser", "editor", "acme"))
+	expectRoleInheritance(mock)
+
+	roles, err := GetOrgRolesByUsername("testuser", "acme")
+	if err != nil {
+		t.Fatalf("GetOrgRolesByUsername() error = %v", err)
+	}
+	if len(roles) != 2 || roles[1].Org != "acme" {
+		t.Errorf("GetOrgRolesByUsername() = %+v, want viewer and editor in acme", roles)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestGetOrgRoleGrant_PrefersOrg(t *testing.T) {
+	mock, cleanup := setupRoleMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "roles" WHERE (username = $1 AND (org = '' OR org = $2) AND (expires_at IS NULL OR expires_at > $3))`)).
+		WithArgs("testuser", "acme", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "deleted_at", "username", "role", "org"}).
+			AddRow(1, nil, nil, nil, "testuser", "editor", "").
+			AddRow(2, nil, nil, nil, "testuser", "editor", "acme"))
+	expectRoleInheritance(mock)
+
+	grant, err := GetOrgRoleGrant("editor", "testuser", "acme")
+	if err != nil {
+		t.Fatalf("GetOrgRoleGrant() error = %v", err)
+	}
+	if grant == nil || grant.Org != "acme" {
+		t.Errorf("GetOrgRoleGrant() = %+v, want the grant in acme", grant)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestRemoveOrgMember(t *testing.T) {
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+	redisMock := setupMockRedis(t)
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{Username: "testuser", Org: "acme"}).
+		SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatalf("SignedString() error = %v", err)
+	}
+
+	mock.ExpectBegin()
+	expectOrgAdmins(mock, "acme", "owner")
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "org_members" WHERE org = $1 AND username = $2`)).
+		WithArgs("acme", "testuser").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "roles" SET "deleted_at"=$1 WHERE (username = $2 AND org = $3)`)).
+		WithArgs(sqlmock.AnyArg(), "testuser", "acme").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+	redisMock.ExpectGet("testuser-token").SetVal(token)
+	redisMock.ExpectDel("testuser-token").SetVal(1)
+
+	if err := RemoveOrgMember("acme", "testuser"); err != nil {
+		t.Errorf("RemoveOrgMember() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+	if err := redisMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled redis expectations: %v", err)
+	}
+}
+
+func TestRemoveOrgMember_LastAdmin(t *testing.T) {
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	mock.ExpectBegin()
+	expectOrgAdmins(mock, "acme", "testuser")
+	mock.ExpectRollback()
+
+	if err := RemoveOrgMember("acme", "testuser"); !errors.Is(err, ErrLastOrgAdmin) {
+		t.Errorf("RemoveOrgMember() error = %v, want %v", err, ErrLastOrgAdmin)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestChangeOrgMemberRole(t *testing.T) {
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	mock.ExpectBegin()
+	expectOrgAdmins(mock, "acme", "owner", "testuser")
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "org_members" SET "role"=$1,"updated_at"=$2 WHERE (org = $3 AND username = $4)`)).
+		WithArgs("member", sqlmock.AnyArg(), "acme", "testuser").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := ChangeOrgMemberRole("acme", "testuser", OrgRoleMember); err != nil {
+		t.Errorf("ChangeOrgMemberRole() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestChangeOrgMemberRole_Invalid(t *testing.T) {
+	if err := ChangeOrgMemberRole("acme", "testuser", "owner"); !errors.Is(err, ErrOrgRoleInvalid) {
+		t.Errorf("ChangeOrgMemberRole() error = %v, want %v", err, ErrOrgRoleInvalid)
+	}
+}
+
+// expectOrgAdmins expects the admin lookup guarding the last admin of org
+func expectOrgAdmins(mock sqlmock.Sqlmock, org string, admins ...string) {
+	rows := sqlmock.NewRows([]string{"username"})
+	for _, admin := range admins {
+		rows.AddRow(admin)
+	}
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "username" FROM "org_members" WHERE (org = $1 AND role = $2) AND "org_members"."deleted_at" IS NULL`)).
+		WithArgs(org, OrgRoleAdmin).
+		WillReturnRows(rows)
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"auth-api-go/models"
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrPasswordReused = errors.New("password was used recently")
+
+// passwordHistorySize is how many previous passwords can't be reused; 0 turns
+// the check off.
+func passwordHistorySize() int {
+	value := os.Getenv("PASSWORD_HISTORY_SIZE")
+	if value == "0" {
+		return 0
+	}
+	return envInt("PASSWORD_HISTORY_SIZE", 5)
+}
+
+func passwordMaxAge() time.Duration {
+	return time.Duration(envInt("PASSWORD_MAX_AGE_DAYS", 90)) * 24 * time.Hour
+}
+
+// passwordRotationRoles are the roles whose holders must rotate their password
+// every PASSWORD_MAX_AGE_DAYS.
+func passwordRotationRoles() []string {
+	var roles []string
+	for _, role := range strings.Split(os.Getenv("PASSWORD_ROTATION_ROLES"), ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+func GetPasswordHistory(username string, limit int) ([]models.PasswordHistory, error) {
+	var history []models.PasswordHistory
+	result := models.DB.Where("username = ?", username).Order("created_at desc").Limit(limit).Find(&history)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return history, nil
+}
+
+// checkPasswordReuse returns ErrPasswordReused when password matches the
+// current hash or one of the last passwordHistorySize() hashes.
+func checkPasswordReuse(ctx context.Context, user *models.User, password string) error {
+	size := passwordHistorySize()
+	if size == 0 {
+		return nil
+	}
+
+	hashes := []string{user.Hash}
+	history, err := GetPasswordHistory(user.Username, size)
+	if err != nil {
+		return err
+	}
+	for _, entry := range history {
+		hashes = append(hashes, entry.Hash)
+	}
+
+	for _, hash := range hashes {
+		isMatch, err := CheckPasswordHashContext(ctx, password, hash)
+		if err != nil {
+			return err
+		}
+		if isMatch {
+			return ErrPasswordReused
+		}
+	}
+	return nil
+}
+
+// savePassword stores the new hash and moves the old one into the history,
+// keeping at most passwordHistorySize() entries.
+func savePassword(user *models.User, hash string) error {
+	size := passwordHistorySize()
+	now := time.Now()
+
+	return models.DB.Transaction(func(tx *gorm.DB) error {
+		if size > 0 {
+			err := tx.Create(&models.PasswordHistory{Username: user.Username, Hash: user.Hash}).Error
+			if err != nil {
+				return err
+			}
+
+			// Old hashes are dropped outright rather than soft-deleted
+			keep := tx.Model(&models.PasswordHistory{}).Select("id").
+				Where("username = ?", user.Username).Order("created_at desc").Limit(size)
+			err = tx.Unscoped().Where("username = ? AND id NOT IN (?)", user.Username, keep).
+				Delete(&models.PasswordHistory{}).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(user).Updates(map[string]interface{}{
+			"hash":                hash,
+			"password_changed_at": now,
+		}).Error
+	})
+}
+
+// IsPasswordExpired reports whether the user holds a role that requires
+// rotation and hasn't changed their password within PASSWORD_MAX_AGE_DAYS.
+func IsPasswordExpired(user *models.User) (bool, error) {
+	rotationRoles := passwordRotationRoles()
+	if len(rotationRoles) == 0 {
+		return false, nil
+	}
+
+	changedAt := user.CreatedAt
+	if user.PasswordChangedAt != nil {
+		changedAt = *user.PasswordChangedAt
+	}
+	if time.Since(changedAt) < passwordMaxAge() {
+		return false, nil
+	}
+
+	roles, err := GetRolesByUsername(user.Username)
+	if err != nil {
+		return false, err
+	}
+	for _, role := range roles {
+		for _, rotationRole := range rotationRoles {
+			if role.Role == rotationRole {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
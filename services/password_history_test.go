@@ -0,0 +1,101 @@
+package services
+
+import (
+	"auth-api-go/models"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestIsPasswordExpired_NoRotationRoles(t *testing.T) {
+	t.Setenv("PASSWORD_ROTATION_ROLES", "")
+
+	user := &models.User{Username: "testuser"}
+
+	isExpired, err := IsPasswordExpired(user)
+	if err != nil {
+		t.Errorf("IsPasswordExpired() error = %v", err)
+	}
+
+	if isExpired {
+		t.Error("IsPasswordExpired() should return false when no roles require rotation")
+	}
+}
+
+func TestIsPasswordExpired_RecentlyChanged(t *testing.T) {
+	t.Setenv("PASSWORD_ROTATION_ROLES", "admin")
+
+	changedAt := time.Now().Add(-24 * time.Hour)
+	user := &models.User{Username: "testuser", PasswordChangedAt: &changedAt}
+
+	isExpired, err := IsPasswordExpired(user)
+	if err != nil {
+		t.Errorf("IsPasswordExpired() error = %v", err)
+	}
+
+	if isExpired {
+		t.Error("IsPasswordExpired() should return false for a recently changed password")
+	}
+}
+
+func TestIsPasswordExpired_RotationRole(t *testing.T) {
+	t.Setenv("PASSWORD_ROTATION_ROLES", "billing, admin")
+
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	rows := sqlmock.NewRows([]string{"id", "created_at", "updated_at", "deleted_at", "username", "role"}).
+		AddRow(1, nil, nil, nil, "testuser", "admin")
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "roles" WHERE (username = $1 AND (org = '' OR org = $2) AND (expires_at IS NULL OR expires_at > $3))`)).
+		WithArgs("testuser", "", sqlmock.AnyArg()).
+		WillReturnRows(rows)
+	expectGroupRoles(mock, "testuser")
+	expectRoleInheritance(mock)
+
+	changedAt := time.Now().Add(-91 * 24 * time.Hour)
+	user := &models.User{Username: "testuser", PasswordChangedAt: &changedAt}
+
+	isExpired, err := IsPasswordExpired(user)
+	if err != nil {
+		t.Errorf("IsPasswordExpired() error = %v", err)
+	}
+
+	if !isExpired {
+		t.Error("IsPasswordExpired() should return true for an old password on a rotation role")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestIsPasswordExpired_OtherRoles(t *testing.T) {
+	t.Setenv("PASSWORD_ROTATION_ROLES", "admin")
+
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	rows := sqlmock.NewRows([]string{"id", "created_at", "updated_at", "deleted_at", "username", "role"}).
+		AddRow(1, nil, nil, nil, "testuser", "user")
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "roles" WHERE (username = $1 AND (org = '' OR org = $2) AND (expires_at IS NULL OR expires_at > $3))`)).
+		WithArgs("testuser", "", sqlmock.AnyArg()).
+		WillReturnRows(rows)
+	expectGroupRoles(mock, "testuser")
+	expectRoleInheritance(mock)
+
+	user := &models.User{Username: "testuser"}
+	user.CreatedAt = time.Now().Add(-365 * 24 * time.Hour)
+
+	isExpired, err := IsPasswordExpired(user)
+	if err != nil {
+		t.Errorf("IsPasswordExpired() error = %v", err)
+	}
+
+	if isExpired {
+		t.Error("IsPasswordExpired() should return false for users without a rotation role")
+	}
+}
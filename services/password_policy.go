@@ -0,0 +1,120 @@
+package services
+
+import (
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// minUsernameCheckLength is the shortest username Validate looks for in a
+// password; shorter ones, like "al", turn up in too many good passwords.
+const minUsernameCheckLength = 4
+
+type PasswordPolicy struct {
+	MinLength        int
+	MaxLength        int
+	DisallowUsername bool
+	RequireUpper     bool
+	RequireLower     bool
+	RequireDigit     bool
+	RequireSymbol    bool
+	BreachedListPath string
+}
+
+type PolicyViolation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicyError lists every rule a password failed, so clients can show
+// all of them at once instead of one per attempt.
+type PasswordPolicyError struct {
+	Violations []PolicyViolation `json:"violations"`
+}
+
+func (e *PasswordPolicyError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, violation := range e.Violations {
+		messages[i] = violation.Message
+	}
+	return "password does not meet policy: " + strings.Join(messages, "; ")
+}
+
+// LoadPasswordPolicy reads the policy from the environment. bcrypt ignores
+// anything past 72 bytes, so that is the default maximum.
+func LoadPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:        envInt("PASSWORD_MIN_LENGTH", 8),
+		MaxLength:        envInt("PASSWORD_MAX_LENGTH", 72),
+		DisallowUsername: os.Getenv("PASSWORD_ALLOW_USERNAME") != "true",
+		RequireUpper:     os.Getenv("PASSWORD_REQUIRE_UPPER") == "true",
+		RequireLower:     os.Getenv("PASSWORD_REQUIRE_LOWER") == "true",
+		RequireDigit:     os.Getenv("PASSWORD_REQUIRE_DIGIT") == "true",
+		RequireSymbol:    os.Getenv("PASSWORD_REQUIRE_SYMBOL") == "true",
+		BreachedListPath: os.Getenv("PASSWORD_BREACHED_LIST"),
+	}
+}
+
+// Validate returns a *PasswordPolicyError when password breaks any rule.
+func (p PasswordPolicy) Validate(username string, password string) error {
+	var violations []PolicyViolation
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, PolicyViolation{"too_short", "password is shorter than the minimum length"})
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		violations = append(violations, PolicyViolation{"too_long", "password is longer than the maximum length"})
+	}
+
+	if p.DisallowUsername && utf8.RuneCountInString(username) >= minUsernameCheckLength && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		violations = append(violations, PolicyViolation{"contains_username", "password must not contain the username"})
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+	if p.RequireUpper && !hasUpper {
+		violations = append(violations, PolicyViolation{"missing_upper", "password must contain an uppercase letter"})
+	}
+	if p.RequireLower && !hasLower {
+		violations = append(violations, PolicyViolation{"missing_lower", "password must contain a lowercase letter"})
+	}
+	if p.RequireDigit && !hasDigit {
+		violations = append(violations, PolicyViolation{"missing_digit", "password must contain a digit"})
+	}
+	if p.RequireSymbol && !hasSymbol {
+		violations = append(violations, PolicyViolation{"missing_symbol", "password must contain a symbol"})
+	}
+
+	if p.BreachedListPath != "" && len(violations) == 0 {
+		breached, err := IsPasswordBreached(p.BreachedListPath, password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			violations = append(violations, PolicyViolation{"breached", "password has appeared in a data breach"})
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// ValidatePassword checks password against the policy from the environment.
+func ValidatePassword(username string, password string) error {
+	return LoadPasswordPolicy().Validate(username, password)
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func violationCodes(err error) []string {
+	var policyErr *PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		return nil
+	}
+	codes := make([]string, len(policyErr.Violations))
+	for i, violation := range policyErr.Violations {
+		codes[i] = violation.Code
+	}
+	return codes
+}
+
+func TestPasswordPolicy_Validate(t *testing.T) {
+	policy := PasswordPolicy{
+		MinLength:        8,
+		MaxLength:        72,
+		DisallowUsername: true,
+		RequireUpper:     true,
+		RequireLower:     true,
+		RequireDigit:     true,
+		RequireSymbol:    true,
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		want     []string
+	}{
+		{
+			name:     "valid password",
+			username: "testuser",
+			password: "C0mpl3x!P@ssw0rd",
+			want:     nil,
+		},
+		{
+			name:     "empty password",
+			username: "testuser",
+			password: "",
+			want:     []string{"too_short", "missing_upper", "missing_lower", "missing_digit", "missing_symbol"},
+		},
+		{
+			name:     "too long",
+			username: "testuser",
+			password: "Aa1!" + strings.Repeat("x", 72),
+			want:     []string{"too_long"},
+		},
+		{
+			name:     "contains username",
+			username: "TestUser",
+			password: "Aa1!testuser",
+			want:     []string{"contains_username"},
+		},
+		{
+			name:     "short username",
+			username: "Al",
+			password: "Aa1!always",
+		},
+		{
+			name:     "missing digit and symbol",
+			username: "testuser",
+			password: "PasswordOnly",
+			want:     []string{"missing_digit", "missing_symbol"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Validate(tt.username, tt.password)
+			got := violationCodes(err)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Validate() violations = %v, want %v", got, tt.want)
+			}
+			if tt.want == nil && err != nil {
+				t.Errorf("Validate() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadPasswordPolicy_Defaults(t *testing.T) {
+	policy := LoadPasswordPolicy()
+
+	if policy.MinLength != 8 {
+		t.Errorf("LoadPasswordPolicy() MinLength = %v, want 8", policy.MinLength)
+	}
+
+	if policy.MaxLength != 72 {
+		t.Errorf("LoadPasswordPolicy() MaxLength = %v, want 72", policy.MaxLength)
+	}
+
+	if !policy.DisallowUsername {
+		t.Error("LoadPasswordPolicy() should disallow the username by default")
+	}
+}
+
+func writeBreachedList(t *testing.T, passwords ...string) string {
+	lines := make([]string, len(passwords))
+	for i, password := range passwords {
+		sum := sha1.Sum([]byte(password))
+		lines[i] = strings.ToUpper(hex.EncodeToString(sum[:])) + ":" + "42"
+	}
+	sort.Strings(lines)
+
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\r\n")+"\r\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write breached list: %v", err)
+	}
+	return path
+}
+
+func TestIsPasswordBreached(t *testing.T) {
+	breachedPasswords := []string{"password", "123456", "qwerty", "letmein", "dragon", "monkey", "iloveyou"}
+	path := writeBreachedList(t, breachedPasswords...)
+
+	for _, password := range breachedPasswords {
+		breached, err := IsPasswordBreached(path, password)
+		if err != nil {
+			t.Fatalf("IsPasswordBreached() error = %v", err)
+		}
+		if !breached {
+			t.Errorf("IsPasswordBreached(%q) = false, want true", password)
+		}
+	}
+
+	breached, err := IsPasswordBreached(path, "C0mpl3x!P@ssw0rd")
+	if err != nil {
+		t.Fatalf("IsPasswordBreached() error = %v", err)
+	}
+	if breached {
+		t.Error("IsPasswordBreached() = true for a password not in the list")
+	}
+}
+
+func TestIsPasswordBreached_MissingFile(t *testing.T) {
+	_, err := IsPasswordBreached(filepath.Join(t.TempDir(), "missing.txt"), "password")
+	if err == nil {
+		t.Error("IsPasswordBreached() should return error for a missing file")
+	}
+}
+
+func TestPasswordPolicy_Breached(t *testing.T) {
+	policy := PasswordPolicy{
+		MinLength:        8,
+		BreachedListPath: writeBreachedList(t, "password123"),
+	}
+
+	codes := violationCodes(policy.Validate("testuser", "password123"))
+	if strings.Join(codes, ",") != "breached" {
+		t.Errorf("Validate() violations = %v, want [breached]", codes)
+	}
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Peppered hashes are stored as "pv<version>:<bcrypt hash>"; plain bcrypt
+// hashes from before peppering was enabled are version 0.
+const pepperPrefix = "pv"
+
+// loadPeppers returns every configured pepper by version and the version new
+// hashes should use. Peppers come from PASSWORD_PEPPER_<version> variables
+// and/or PASSWORD_PEPPER_FILE, a file of "<version>:<secret>" lines, so they
+// never live in the database. PASSWORD_PEPPER_VERSION picks the current
+// version and defaults to the highest one configured.
+func loadPeppers() (map[int][]byte, int, error) {
+	peppers := make(map[int][]byte)
+
+	for _, env := range os.Environ() {
+		name, value, _ := strings.Cut(env, "=")
+		version, err := strconv.Atoi(strings.TrimPrefix(name, "PASSWORD_PEPPER_"))
+		if !strings.HasPrefix(name, "PASSWORD_PEPPER_") || err != nil || version <= 0 || value == "" {
+			continue
+		}
+		peppers[version] = []byte(value)
+	}
+
+	if path := os.Getenv("PASSWORD_PEPPER_FILE"); path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, 0, fmt.Errorf("error opening pepper file: %v", err)
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			versionText, secret, found := strings.Cut(line, ":")
+			version, err := strconv.Atoi(versionText)
+			if !found || err != nil || version <= 0 || secret == "" {
+				return nil, 0, fmt.Errorf("invalid line in pepper file")
+			}
+			peppers[version] = []byte(secret)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, 0, fmt.Errorf("error reading pepper file: %v", err)
+		}
+	}
+
+	current := 0
+	for version := range peppers {
+		if version > current {
+			current = version
+		}
+	}
+	if value := os.Getenv("PASSWORD_PEPPER_VERSION"); value != "" {
+		version, err := strconv.Atoi(value)
+		if err != nil || peppers[version] == nil {
+			return nil, 0, fmt.Errorf("no pepper configured for version %q", value)
+		}
+		current = version
+	}
+
+	return peppers, current, nil
+}
+
+// applyPepper HMACs password with the pepper for version. The base64 digest
+// is 44 bytes, which also keeps long passwords under bcrypt's 72 byte limit.
+func applyPepper(peppers map[int][]byte, version int, password string) (string, error) {
+	if version == 0 {
+		return password, nil
+	}
+
+	pepper, ok := peppers[version]
+	if !ok {
+		return "", fmt.Errorf("no pepper configured for version %d", version)
+	}
+
+	mac := hmac.New(sha256.New, pepper)
+	mac.Write([]byte(password))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// splitPepperVersion separates a stored hash into its pepper version and the
+// underlying bcrypt hash.
+func splitPepperVersion(hash string) (int, string) {
+	if !strings.HasPrefix(hash, pepperPrefix) {
+		return 0, hash
+	}
+
+	versionText, bcryptHash, found := strings.Cut(strings.TrimPrefix(hash, pepperPrefix), ":")
+	version, err := strconv.Atoi(versionText)
+	if !found || err != nil {
+		return 0, hash
+	}
+	return version, bcryptHash
+}
+
+func joinPepperVersion(version int, bcryptHash string) string {
+	if version == 0 {
+		return bcryptHash
+	}
+	return pepperPrefix + strconv.Itoa(version) + ":" + bcryptHash
+}
+
+// NeedsRehash reports whether hash was made with a pepper version other than
+// the current one and should be replaced on the next successful login.
+func NeedsRehash(hash string) bool {
+	_, current, err := loadPeppers()
+	if err != nil {
+		return false
+	}
+	version, _ := splitPepperVersion(hash)
+	return version != current
+}
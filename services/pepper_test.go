@@ -0,0 +1,115 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHashPassword_Peppered(t *testing.T) {
+	t.Setenv("PASSWORD_PEPPER_1", "first-pepper")
+
+	hash, err := HashPassword("password123")
+	if err != nil {
+		t.Fatalf("HashPassword() error = %v", err)
+	}
+
+	if !strings.HasPrefix(hash, "pv1:$2a$") {
+		t.Errorf("HashPassword() = %v, want pepper version 1 prefix", hash)
+	}
+
+	if !CheckPasswordHash("password123", hash) {
+		t.Error("CheckPasswordHash() should return true for a peppered hash")
+	}
+
+	if NeedsRehash(hash) {
+		t.Error("NeedsRehash() should return false for the current pepper version")
+	}
+
+	// Rotate to a new pepper while keeping the old one for verification
+	t.Setenv("PASSWORD_PEPPER_2", "second-pepper")
+
+	if !CheckPasswordHash("password123", hash) {
+		t.Error("CheckPasswordHash() should still verify hashes made with an older pepper")
+	}
+
+	if !NeedsRehash(hash) {
+		t.Error("NeedsRehash() should return true after the pepper is rotated")
+	}
+}
+
+func TestCheckPasswordHash_MissingPepper(t *testing.T) {
+	t.Setenv("PASSWORD_PEPPER_1", "first-pepper")
+
+	hash, err := HashPassword("password123")
+	if err != nil {
+		t.Fatalf("HashPassword() error = %v", err)
+	}
+
+	os.Unsetenv("PASSWORD_PEPPER_1")
+
+	isMatch, err := CheckPasswordHashContext(t.Context(), "password123", hash)
+	if err == nil {
+		t.Error("CheckPasswordHashContext() should return error when the pepper is missing")
+	}
+
+	if isMatch {
+		t.Error("CheckPasswordHashContext() should return false when the pepper is missing")
+	}
+}
+
+func TestNeedsRehash_Unpeppered(t *testing.T) {
+	if NeedsRehash("$2a$14$hashedpassword") {
+		t.Error("NeedsRehash() should return false when no pepper is configured")
+	}
+
+	t.Setenv("PASSWORD_PEPPER_1", "first-pepper")
+
+	if !NeedsRehash("$2a$14$hashedpassword") {
+		t.Error("NeedsRehash() should return true for unpeppered hashes once a pepper is configured")
+	}
+}
+
+func TestLoadPeppers_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peppers")
+	err := os.WriteFile(path, []byte("# old\n1:first-pepper\n3:third-pepper\n"), 0o600)
+	if err != nil {
+		t.Fatalf("Failed to write pepper file: %v", err)
+	}
+	t.Setenv("PASSWORD_PEPPER_FILE", path)
+
+	peppers, current, err := loadPeppers()
+	if err != nil {
+		t.Fatalf("loadPeppers() error = %v", err)
+	}
+
+	if current != 3 {
+		t.Errorf("loadPeppers() current = %v, want 3", current)
+	}
+
+	if string(peppers[1]) != "first-pepper" {
+		t.Errorf("loadPeppers() version 1 = %v, want first-pepper", string(peppers[1]))
+	}
+
+	t.Setenv("PASSWORD_PEPPER_VERSION", "1")
+
+	_, current, err = loadPeppers()
+	if err != nil {
+		t.Fatalf("loadPeppers() error = %v", err)
+	}
+
+	if current != 1 {
+		t.Errorf("loadPeppers() current = %v, want 1", current)
+	}
+}
+
+func TestLoadPeppers_UnknownVersion(t *testing.T) {
+	t.Setenv("PASSWORD_PEPPER_1", "first-pepper")
+	t.Setenv("PASSWORD_PEPPER_VERSION", "2")
+
+	_, _, err := loadPeppers()
+	if err == nil {
+		t.Error("loadPeppers() should return error when the current version has no pepper")
+	}
+}
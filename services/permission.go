@@ -0,0 +1,161 @@
+package services
+
+import (
+	"auth-api-go/models"
+	"errors"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrPermissionInvalid  = errors.New("permission must look like resource:action")
+	ErrPermissionExists   = errors.New("role already has permission")
+	ErrPermissionNotFound = errors.New("role does not have permission")
+)
+
+// validatePermission accepts "resource:action", "resource:*" and "*"
+func validatePermission(permission string) error {
+	if permission == "*" {
+		return nil
+	}
+	resource, action, found := strings.Cut(permission, ":")
+	if !found || resource == "" || action == "" || strings.Contains(resource, "*") || strings.ContainsAny(permission, " /") {
+		return ErrPermissionInvalid
+	}
+	return nil
+}
+
+// permissionMatches reports whether granted covers wanted
+func permissionMatches(granted string, wanted string) bool {
+	if granted == "*" || granted == wanted {
+		return true
+	}
+	if resource, found := strings.CutSuffix(granted, ":*"); found {
+		return strings.HasPrefix(wanted, resource+":")
+	}
+	return false
+}
+
+// anyPermissionMatches reports whether any of granted covers wanted
+func anyPermissionMatches(granted []string, wanted string) bool {
+	for _, permission := range granted {
+		if permissionMatches(permission, wanted) {
+			return true
+		}
+	}
+	return false
+}
+
+func GetRolePermissions(role string) ([]models.RolePermission, error) {
+	var permissions []models.RolePermission
+	result := models.DB.Order("permission").Find(&permissions, "role = ?", role)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return permissions, nil
+}
+
+// AddRolePermission grants permission to every holder of role, which has to
+// be in the catalog.
+func AddRolePermission(role string, permission string) error {
+	if err := validatePermission(permission); err != nil {
+		return err
+	}
+
+	_, err := GetRoleDefinition(role)
+	if err != nil {
+		return err
+	}
+
+	permissionEntry := &models.RolePermission{
+		Role:       role,
+		Permission: permission,
+	}
+
+	err = models.DB.Create(permissionEntry).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrPermissionExists
+	}
+	if err != nil {
+		return err
+	}
+
+	return roleHoldersChanged(role)
+}
+
+// RemoveRolePermission deletes the row outright so the permission can be
+// granted again later without tripping the unique index.
+func RemoveRolePermission(role string, permission string) error {
+	result := models.DB.Unscoped().Where("role = ? AND permission = ?", role, permission).Delete(&models.RolePermission{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrPermissionNotFound
+	}
+	return roleHoldersChanged(role)
+}
+
+// GetPermissionsByUsername returns every permission granted through
+// username's roles, sorted and without duplicates.
+func GetPermissionsByUsername(username string) ([]string, error) {
+	return GetOrgPermissionsByUsername(username, "")
+}
+
+// GetOrgPermissionsByUsername is GetPermissionsByUsername for the roles
+// username holds in org
+func GetOrgPermissionsByUsername(username string, org string) ([]string, error) {
+	roles, err := GetOrgRolesByUsername(username, org)
+	if err != nil {
+		return nil, err
+	}
+	return getPermissionsForRoles(roles)
+}
+
+// getPermissionsForRoles returns the permissions granted to the given
+// effective roles, sorted and without duplicates.
+func getPermissionsForRoles(roles []models.Roles) ([]string, error) {
+	if len(roles) == 0 {
+		return []string{}, nil
+	}
+
+	roleNames := make([]string, 0, len(roles))
+	for _, role := range roles {
+		roleNames = append(roleNames, role.Role)
+	}
+
+	var rolePermissions []models.RolePermission
+	result := models.DB.Find(&rolePermissions, "role IN ?", roleNames)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	seen := make(map[string]bool)
+	permissions := []string{}
+	for _, rolePermission := range rolePermissions {
+		if !seen[rolePermission.Permission] {
+			seen[rolePermission.Permission] = true
+			permissions = append(permissions, rolePermission.Permission)
+		}
+	}
+	sort.Strings(permissions)
+
+	return permissions, nil
+}
+
+// HasPermission reports whether any of username's roles grants permission,
+// directly or through a wildcard.
+func HasPermission(username string, permission string) (bool, error) {
+	return HasOrgPermission(username, "", permission)
+}
+
+// HasOrgPermission is HasPermission for the roles username holds in org
+func HasOrgPermission(username string, org string, permission string) (bool, error) {
+	permissions, err := GetOrgPermissionsByUsername(username, org)
+	if err != nil {
+		return false, err
+	}
+	return anyPermissionMatches(permissions, permission), nil
+}
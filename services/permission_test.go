@@ -0,0 +1,115 @@
+package services
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestPermissionMatches(t *testing.T) {
+	tests := []struct {
+		granted string
+		wanted  string
+		want    bool
+	}{
+		{"invoices:write", "invoices:write", true},
+		{"invoices:read", "invoices:write", false},
+		{"invoices:*", "invoices:write", true},
+		{"invoices:*", "invoicesx:write", false},
+		{"*", "reports:read", true},
+	}
+
+	for _, tt := range tests {
+		if got := permissionMatches(tt.granted, tt.wanted); got != tt.want {
+			t.Errorf("permissionMatches(%q, %q) = %v, want %v", tt.granted, tt.wanted, got, tt.want)
+		}
+	}
+}
+
+func TestValidatePermission(t *testing.T) {
+	valid := []string{"invoices:write", "invoices:*", "*"}
+	for _, permission := range valid {
+		if err := validatePermission(permission); err != nil {
+			t.Errorf("validatePermission(%q) error = %v", permission, err)
+		}
+	}
+
+	invalid := []string{"", "invoices", ":write", "invoices:", "*:write", "invoices:write all"}
+	for _, permission := range invalid {
+		if err := validatePermission(permission); !errors.Is(err, ErrPermissionInvalid) {
+			t.Errorf("validatePermission(%q) error = %v, want %v", permission, err, ErrPermissionInvalid)
+		}
+	}
+}
+
+func TestHasPermission(t *testing.T) {
+	mock, cleanup := setupRoleMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "roles" WHERE (username = $1 AND (org = '' OR org = $2) AND (expires_at IS NULL OR expires_at > $3))`)).
+		WithArgs("testuser", "", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "deleted_at", "username", "role"}).
+			AddRow(1, nil, nil, nil, "testuser", "billing").
+			AddRow(2, nil, nil, nil, "testuser", "viewer"))
+	expectGroupRoles(mock, "testuser")
+	expectRoleInheritance(mock)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "role_permissions" WHERE role IN ($1,$2)`)).
+		WithArgs("billing", "viewer").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "deleted_at", "role", "permission"}).
+			AddRow(1, nil, nil, nil, "billing", "invoices:*").
+			AddRow(2, nil, nil, nil, "viewer", "reports:read"))
+
+	hasPermission, err := HasPermission("testuser", "invoices:write")
+	if err != nil {
+		t.Errorf("HasPermission() error = %v", err)
+	}
+	if !hasPermission {
+		t.Error("HasPermission() should match the invoices:* wildcard")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestHasPermission_NoRoles(t *testing.T) {
+	mock, cleanup := setupRoleMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "roles" WHERE (username = $1 AND (org = '' OR org = $2) AND (expires_at IS NULL OR expires_at > $3))`)).
+		WithArgs("testuser", "", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "deleted_at", "username", "role"}))
+	expectGroupRoles(mock, "testuser")
+
+	hasPermission, err := HasPermission("testuser", "invoices:write")
+	if err != nil {
+		t.Errorf("HasPermission() error = %v", err)
+	}
+	if hasPermission {
+		t.Error("HasPermission() should be false for a user without roles")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestAddRolePermission_Undefined(t *testing.T) {
+	mock, cleanup := setupRoleMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "role_definitions" WHERE name = $1`)).
+		WithArgs("edtior", 1).
+		WillReturnRows(sqlmock.NewRows(roleDefinitionColumns))
+
+	err := AddRolePermission("edtior", "invoices:write")
+	if !errors.Is(err, ErrRoleUndefined) {
+		t.Errorf("AddRolePermission() error = %v, want %v", err, ErrRoleUndefined)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
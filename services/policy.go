@@ -0,0 +1,339 @@
+package services
+
+import (
+	"auth-api-go/models"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"cel.dev/cel-go/cel"
+	"cel.dev/cel-go/common/types"
+	"cel.dev/cel-go/common/types/ref"
+	"gorm.io/gorm"
+)
+
+const (
+	PolicyAllow = "allow"
+	PolicyDeny  = "deny"
+)
+
+var (
+	ErrPolicyExists   = errors.New("policy name is already taken")
+	ErrPolicyNotFound = errors.New("policy not found")
+)
+
+// PolicyInvalidError explains why a policy was rejected, e.g. a CEL
+// expression that doesn't compile.
+type PolicyInvalidError struct {
+	Reason string
+}
+
+func (e *PolicyInvalidError) Error() string {
+	return "invalid policy: " + e.Reason
+}
+
+// PolicyRequest is what a policy decision is asked about
+type PolicyRequest struct {
+	Action   string                 `json:"action"`
+	Resource map[string]interface{} `json:"resource"`
+	IP       string                 `json:"-"`
+	// Org is the tenant the request was made in
+	Org string `json:"-"`
+}
+
+type PolicyDecision struct {
+	Allowed bool     `json:"allowed"`
+	Allow   []string `json:"allow"` // names of matching allow policies
+	Deny    []string `json:"deny"`  // names of matching deny policies
+	// Errors holds policies that failed to evaluate. A failing deny policy
+	// counts as matching so errors never grant access.
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+var (
+	policyEnvOnce sync.Once
+	policyEnv     *cel.Env
+	policyEnvErr  error
+
+	// Compiled programs by policy ID, one entry per policy
+	policyPrograms sync.Map
+)
+
+// compiledPolicy remembers the expression a program was compiled from, so
+// an edit made on another replica is noticed and recompiled.
+type compiledPolicy struct {
+	expression string
+	program    cel.Program
+}
+
+// getPolicyEnv declares what expressions can use:
+//
+//	subject  map with username, email, roles and permissions
+//	resource map passed in by the caller
+//	action   the action being decided, e.g. "documents:edit"
+//	env      map with time (a timestamp) and ip
+//
+// plus ipInRange(ip, cidr).
+func getPolicyEnv() (*cel.Env, error) {
+	policyEnvOnce.Do(func() {
+		policyEnv, policyEnvErr = cel.NewEnv(
+			cel.Variable("subject", cel.MapType(cel.StringType, cel.DynType)),
+			cel.Variable("resource", cel.MapType(cel.StringType, cel.DynType)),
+			cel.Variable("action", cel.StringType),
+			cel.Variable("env", cel.MapType(cel.StringType, cel.DynType)),
+			cel.Function("ipInRange",
+				cel.Overload("ip_in_range_string_string", []*cel.Type{cel.StringType, cel.StringType}, cel.BoolType,
+					cel.BinaryBinding(ipInRange))),
+		)
+	})
+	return policyEnv, policyEnvErr
+}
+
+func ipInRange(ipVal ref.Val, cidrVal ref.Val) ref.Val {
+	ip := net.ParseIP(fmt.Sprint(ipVal.Value()))
+	_, network, err := net.ParseCIDR(fmt.Sprint(cidrVal.Value()))
+	if err != nil {
+		return types.NewErr("invalid cidr %v", cidrVal.Value())
+	}
+	return types.Bool(ip != nil && network.Contains(ip))
+}
+
+func compilePolicy(expression string) (cel.Program, error) {
+	env, err := getPolicyEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	ast, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, &PolicyInvalidError{Reason: issues.Err().Error()}
+	}
+	if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+		return nil, &PolicyInvalidError{Reason: "expression must return a bool"}
+	}
+
+	return env.Program(ast)
+}
+
+func validatePolicy(policy *models.Policy) error {
+	if policy.Name == "" {
+		return &PolicyInvalidError{Reason: "name is required"}
+	}
+	if policy.Effect != PolicyAllow && policy.Effect != PolicyDeny {
+		return &PolicyInvalidError{Reason: `effect must be "allow" or "deny"`}
+	}
+	if validatePermission(policy.Action) != nil {
+		return &PolicyInvalidError{Reason: "action must look like resource:action"}
+	}
+	_, err := compilePolicy(policy.Expression)
+	return err
+}
+
+// getPolicyProgram compiles each policy once per version of its expression
+func getPolicyProgram(policy models.Policy) (cel.Program, error) {
+	if cached, ok := policyPrograms.Load(policy.ID); ok && cached.(compiledPolicy).expression == policy.Expression {
+		return cached.(compiledPolicy).program, nil
+	}
+
+	program, err := compilePolicy(policy.Expression)
+	if err != nil {
+		return nil, err
+	}
+	policyPrograms.Store(policy.ID, compiledPolicy{expression: policy.Expression, program: program})
+	return program, nil
+}
+
+func GetPolicies() ([]models.Policy, error) {
+	var policies []models.Policy
+	result := models.DB.Order("name").Find(&policies)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return policies, nil
+}
+
+// CreatePolicy stores policy after checking its expression compiles
+func CreatePolicy(policy *models.Policy) error {
+	if err := validatePolicy(policy); err != nil {
+		return err
+	}
+
+	err := models.DB.Create(policy).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrPolicyExists
+	}
+	return err
+}
+
+// PolicyUpdate holds the fields to change; nil fields are left alone
+type PolicyUpdate struct {
+	Description *string `json:"description"`
+	Action      *string `json:"action"`
+	Effect      *string `json:"effect"`
+	Expression  *string `json:"expression"`
+	Enabled     *bool   `json:"enabled"`
+}
+
+func UpdatePolicy(id uint, update PolicyUpdate) (*models.Policy, error) {
+	var policy models.Policy
+	err := models.DB.First(&policy, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrPolicyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if update.Description != nil {
+		policy.Description = *update.Description
+	}
+	if update.Action != nil {
+		policy.Action = *update.Action
+	}
+	if update.Effect != nil {
+		policy.Effect = *update.Effect
+	}
+	if update.Expression != nil {
+		policy.Expression = *update.Expression
+	}
+	if update.Enabled != nil {
+		policy.Enabled = *update.Enabled
+	}
+
+	if err := validatePolicy(&policy); err != nil {
+		return nil, err
+	}
+
+	err = models.DB.Save(&policy).Error
+	if err != nil {
+		return nil, err
+	}
+	policyPrograms.Delete(id)
+	return &policy, nil
+}
+
+// DeletePolicy hard-deletes the policy so its name can be used again
+func DeletePolicy(id uint) error {
+	result := models.DB.Unscoped().Delete(&models.Policy{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrPolicyNotFound
+	}
+	policyPrograms.Delete(id)
+	return nil
+}
+
+// DecidePolicy evaluates the enabled policies for req.Action on behalf of
+// username. Nothing is allowed unless an allow policy says so. A req.Org the
+// user isn't a member of fails with ErrNotOrgMember, so subject.org can be
+// trusted by policies.
+func DecidePolicy(username string, req PolicyRequest) (*PolicyDecision, error) {
+	if validatePermission(req.Action) != nil || strings.Contains(req.Action, "*") {
+		return nil, &PolicyInvalidError{Reason: "action must look like resource:action"}
+	}
+
+	user, err := GetUserByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Org != "" {
+		isMember, err := IsOrgMember(req.Org, username)
+		if err != nil {
+			return nil, err
+		}
+		if !isMember {
+			return nil, ErrNotOrgMember
+		}
+	}
+
+	roles, err := GetOrgRolesByUsername(username, req.Org)
+	if err != nil {
+		return nil, err
+	}
+	permissions, err := getPermissionsForRoles(roles)
+	if err != nil {
+		return nil, err
+	}
+	roleNames := []string{}
+	for _, role := range roles {
+		roleNames = append(roleNames, role.Role)
+	}
+
+	var policies []models.Policy
+	result := models.DB.Where("enabled = ?", true).Order("name").Find(&policies)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	resource := req.Resource
+	if resource == nil {
+		resource = map[string]interface{}{}
+	}
+	vars := map[string]interface{}{
+		"subject": map[string]interface{}{
+			"username":    user.Username,
+			"email":       user.Email,
+			"roles":       roleNames,
+			"permissions": permissions,
+			"org":         req.Org,
+		},
+		"resource": resource,
+		"action":   req.Action,
+		"env": map[string]interface{}{
+			"time": time.Now(),
+			"ip":   req.IP,
+		},
+	}
+
+	decision := &PolicyDecision{Allow: []string{}, Deny: []string{}}
+	for _, policy := range policies {
+		if !permissionMatches(policy.Action, req.Action) {
+			continue
+		}
+
+		matched, err := evaluatePolicy(policy, vars)
+		if err != nil {
+			if decision.Errors == nil {
+				decision.Errors = make(map[string]string)
+			}
+			decision.Errors[policy.Name] = err.Error()
+			matched = policy.Effect == PolicyDeny
+		}
+		if !matched {
+			continue
+		}
+
+		if policy.Effect == PolicyDeny {
+			decision.Deny = append(decision.Deny, policy.Name)
+		} else {
+			decision.Allow = append(decision.Allow, policy.Name)
+		}
+	}
+
+	decision.Allowed = len(decision.Allow) > 0 && len(decision.Deny) == 0
+	return decision, nil
+}
+
+func evaluatePolicy(policy models.Policy, vars map[string]interface{}) (bool, error) {
+	program, err := getPolicyProgram(policy)
+	if err != nil {
+		return false, err
+	}
+
+	out, _, err := program.Eval(vars)
+	if err != nil {
+		return false, err
+	}
+
+	matched, ok := out.Value().(bool)
+	if !ok {
+		return false, errors.New("expression did not return a bool")
+	}
+	return matched, nil
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"auth-api-go/models"
+	"errors"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var policyColumns = []string{"id", "created_at", "updated_at", "deleted_at", "name", "description", "action", "effect", "expression", "enabled", "created_by"}
+
+func TestValidatePolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy models.Policy
+		valid  bool
+	}{
+		{"valid", models.Policy{Name: "own-org", Action: "documents:edit", Effect: PolicyAllow, Expression: `resource.owner == subject.username`}, true},
+		{"ip range", models.Policy{Name: "office", Action: "*", Effect: PolicyDeny, Expression: `!ipInRange(env.ip, "10.0.0.0/8")`}, true},
+		{"bad effect", models.Policy{Name: "x", Action: "documents:edit", Effect: "maybe", Expression: `true`}, false},
+		{"bad action", models.Policy{Name: "x", Action: "documents", Effect: PolicyAllow, Expression: `true`}, false},
+		{"syntax error", models.Policy{Name: "x", Action: "documents:edit", Effect: PolicyAllow, Expression: `resource.owner ==`}, false},
+		{"not bool", models.Policy{Name: "x", Action: "documents:edit", Effect: PolicyAllow, Expression: `"yes"`}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePolicy(&tt.policy)
+			var invalid *PolicyInvalidError
+			if tt.valid && err != nil {
+				t.Errorf("validatePolicy() error = %v", err)
+			}
+			if !tt.valid && !errors.As(err, &invalid) {
+				t.Errorf("validatePolicy() error = %v, want PolicyInvalidError", err)
+			}
+		})
+	}
+}
+
+func TestDecidePolicy(t *testing.T) {
+	mock, cleanup := setupRoleMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE username = $1`)).
+		WithArgs("testuser", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "hash", "email"}).
+			AddRow(1, "testuser", "hash", "test@example.com"))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "roles" WHERE (username = $1 AND (org = '' OR org = $2) AND (expires_at IS NULL OR expires_at > $3))`)).
+		WithArgs("testuser", "", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "deleted_at", "username", "role"}))
+	expectGroupRoles(mock, "testuser")
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "policies" WHERE enabled = $1`)).
+		WithArgs(true).
+		WillReturnRows(sqlmock.NewRows(policyColumns).
+			AddRow(1, nil, nil, nil, "owner-edits", "", "documents:*", PolicyAllow, `resource.owner == subject.username`, true, "admin").
+			AddRow(2, nil, nil, nil, "office-only", "", "*", PolicyDeny, `!ipInRange(env.ip, "10.0.0.0/8")`, true, "admin").
+			AddRow(3, nil, nil, nil, "invoices", "", "invoices:*", PolicyAllow, `true`, true, "admin"))
+
+	decision, err := DecidePolicy("testuser", PolicyRequest{
+		Action:   "documents:edit",
+		Resource: map[string]interface{}{"owner": "testuser"},
+		IP:       "10.1.2.3",
+	})
+	if err != nil {
+		t.Fatalf("DecidePolicy() error = %v", err)
+	}
+
+	if !decision.Allowed {
+		t.Errorf("DecidePolicy() = %+v, want allowed", decision)
+	}
+	if want := []string{"owner-edits"}; !reflect.DeepEqual(decision.Allow, want) {
+		t.Errorf("DecidePolicy() allow = %v, want %v", decision.Allow, want)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestDecidePolicy_ErrorDenies(t *testing.T) {
+	mock, cleanup := setupRoleMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE username = $1`)).
+		WithArgs("testuser", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "hash", "email"}).
+			AddRow(1, "testuser", "hash", ""))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "roles" WHERE (username = $1 AND (org = '' OR org = $2) AND (expires_at IS NULL OR expires_at > $3))`)).
+		WithArgs("testuser", "", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "deleted_at", "username", "role"}))
+	expectGroupRoles(mock, "testuser")
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "policies" WHERE enabled = $1`)).
+		WithArgs(true).
+		WillReturnRows(sqlmock.NewRows(policyColumns).
+			AddRow(1, nil, nil, nil, "anyone", "", "*", PolicyAllow, `true`, true, "admin").
+			AddRow(2, nil, nil, nil, "classified", "", "*", PolicyDeny, `resource.level > 3`, true, "admin"))
+
+	// resource.level is missing, so the deny policy fails to evaluate
+	decision, err := DecidePolicy("testuser", PolicyRequest{Action: "documents:read"})
+	if err != nil {
+		t.Fatalf("DecidePolicy() error = %v", err)
+	}
+
+	if decision.Allowed {
+		t.Error("DecidePolicy() should deny when a deny policy fails to evaluate")
+	}
+	if _, ok := decision.Errors["classified"]; !ok {
+		t.Errorf("DecidePolicy() errors = %v, want classified", decision.Errors)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestGetPolicyProgram_ExpressionChanged(t *testing.T) {
+	policy := models.Policy{Expression: `action == "documents:read"`}
+	policy.ID = 42
+	defer policyPrograms.Delete(policy.ID)
+
+	vars := map[string]interface{}{"subject": map[string]interface{}{}, "resource": map[string]interface{}{}, "action": "documents:read", "env": map[string]interface{}{}}
+	matched, err := evaluatePolicy(policy, vars)
+	if err != nil || !matched {
+		t.Fatalf("evaluatePolicy() = %v, %v, want true", matched, err)
+	}
+
+	// Edited elsewhere; the cached program must not be reused
+	policy.Expression = `action == "documents:edit"`
+	matched, err = evaluatePolicy(policy, vars)
+	if err != nil || matched {
+		t.Errorf("evaluatePolicy() = %v, %v, want false after the expression changed", matched, err)
+	}
+}
+
+func TestDeletePolicy(t *testing.T) {
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "policies" WHERE "policies"."id" = $1`)).
+		WithArgs(3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := DeletePolicy(3); err != nil {
+		t.Errorf("DeletePolicy() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestDecidePolicy_NotOrgMember(t *testing.T) {
+	mock, cleanup := setupRoleMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE username = $1`)).
+		WithArgs("testuser", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "hash", "email"}).
+			AddRow(1, "testuser", "hash", ""))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "org_members" WHERE (org = $1 AND username = $2)`)).
+		WithArgs("acme", "testuser").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	_, err := DecidePolicy("testuser", PolicyRequest{Action: "documents:read", Org: "acme"})
+	if !errors.Is(err, ErrNotOrgMember) {
+		t.Errorf("DecidePolicy() error = %v, want %v", err, ErrNotOrgMember)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
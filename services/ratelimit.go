@@ -0,0 +1,81 @@
+package services
+
+import (
+	"auth-api-go/redis"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int64
+	Remaining int64
+	Reset     time.Duration
+}
+
+// slidingWindowScript keeps one sorted set entry per request, scored by its
+// time in milliseconds. Entries older than the window are dropped before
+// counting, and the request is only recorded if it is allowed. It returns
+// {allowed, remaining, milliseconds until the oldest entry leaves the window}.
+var slidingWindowScript = goredis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', key, 0, now - window)
+local count = redis.call('ZCARD', key)
+
+local allowed = 0
+if count < limit then
+	redis.call('ZADD', key, now, ARGV[4])
+	count = count + 1
+	allowed = 1
+end
+redis.call('PEXPIRE', key, window)
+
+local reset = window
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+if oldest[2] then
+	reset = tonumber(oldest[2]) + window - now
+end
+
+return {allowed, limit - count, reset}
+`)
+
+// CheckRateLimit counts a request against key and reports whether it fits in
+// limit requests per window. The check runs as a single script, so replicas
+// sharing Redis enforce one combined limit.
+func CheckRateLimit(key string, limit int64, window time.Duration) (*RateLimitResult, error) {
+	ctx := context.Background()
+
+	// Requests in the same millisecond still need distinct members
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("error generating rate limit nonce: %v", err)
+	}
+	now := time.Now().UnixMilli()
+	member := fmt.Sprintf("%d-%s", now, hex.EncodeToString(nonce))
+
+	values, err := slidingWindowScript.Run(ctx, redis.REDIS, []string{"ratelimit:" + key},
+		now, window.Milliseconds(), limit, member).Int64Slice()
+	if err != nil {
+		fmt.Println("error with redis rate limit script", err.Error())
+		return nil, fmt.Errorf("error with redis rate limit script: %v", err)
+	}
+	if len(values) != 3 {
+		return nil, fmt.Errorf("unexpected rate limit script result: %v", values)
+	}
+
+	return &RateLimitResult{
+		Allowed:   values[0] == 1,
+		Limit:     limit,
+		Remaining: values[1],
+		Reset:     time.Duration(values[2]) * time.Millisecond,
+	}, nil
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCheckRateLimit_Allowed(t *testing.T) {
+	mock := setupMockRedis(t)
+
+	mock.Regexp().ExpectEvalSha(slidingWindowScript.Hash(), []string{"ratelimit:login:ip:10.0.0.1"}, `^\d+$`, `^60000$`, `^10$`, `^\d+-[0-9a-f]{16}$`).
+		SetVal([]interface{}{int64(1), int64(9), int64(60000)})
+
+	result, err := CheckRateLimit("login:ip:10.0.0.1", 10, time.Minute)
+	if err != nil {
+		t.Fatalf("CheckRateLimit() error = %v", err)
+	}
+
+	if !result.Allowed {
+		t.Error("CheckRateLimit() should allow a request under the limit")
+	}
+
+	if result.Remaining != 9 {
+		t.Errorf("CheckRateLimit() remaining = %v, want 9", result.Remaining)
+	}
+
+	if result.Reset != time.Minute {
+		t.Errorf("CheckRateLimit() reset = %v, want %v", result.Reset, time.Minute)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestCheckRateLimit_Exceeded(t *testing.T) {
+	mock := setupMockRedis(t)
+
+	mock.Regexp().ExpectEvalSha(slidingWindowScript.Hash(), []string{"ratelimit:login:ip:10.0.0.1"}, `^\d+$`, `^60000$`, `^10$`, `.+`).
+		SetVal([]interface{}{int64(0), int64(0), int64(1500)})
+
+	result, err := CheckRateLimit("login:ip:10.0.0.1", 10, time.Minute)
+	if err != nil {
+		t.Fatalf("CheckRateLimit() error = %v", err)
+	}
+
+	if result.Allowed {
+		t.Error("CheckRateLimit() should reject a request over the limit")
+	}
+
+	if result.Reset != 1500*time.Millisecond {
+		t.Errorf("CheckRateLimit() reset = %v, want 1.5s", result.Reset)
+	}
+}
+
+func TestCheckRateLimit_RedisError(t *testing.T) {
+	mock := setupMockRedis(t)
+
+	mock.Regexp().ExpectEvalSha(slidingWindowScript.Hash(), []string{"ratelimit:login:ip:10.0.0.1"}, `.+`, `.+`, `.+`, `.+`).
+		SetErr(errors.New("redis connection error"))
+
+	result, err := CheckRateLimit("login:ip:10.0.0.1", 10, time.Minute)
+	if err == nil {
+		t.Error("CheckRateLimit() should return error on Redis failure")
+	}
+
+	if result != nil {
+		t.Error("CheckRateLimit() should return nil result on error")
+	}
+}
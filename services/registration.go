@@ -0,0 +1,159 @@
+package services
+
+import (
+	"auth-api-go/models"
+	"context"
+	"errors"
+	"os"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Registration modes, set with REGISTRATION_MODE
+const (
+	RegistrationOpen            = "open"
+	RegistrationDisabled        = "disabled"
+	RegistrationInviteOnly      = "invite-only"
+	RegistrationDomainAllowlist = "email-domain-allowlist"
+)
+
+var (
+	ErrRegistrationDisabled  = errors.New("registration is disabled")
+	ErrInviteRequired        = errors.New("an invite code is required")
+	ErrEmailRequired         = errors.New("an email address is required")
+	ErrEmailDomainNotAllowed = errors.New("email domain is not allowed")
+)
+
+type Registration struct {
+	Username   string
+	Password   string
+	Email      string
+	InviteCode string
+	// OrgInvitation is an organization invitation token to accept on signup
+	OrgInvitation string
+}
+
+func RegistrationMode() string {
+	mode := os.Getenv("REGISTRATION_MODE")
+	if mode == "" {
+		return RegistrationOpen
+	}
+	return mode
+}
+
+// allowedEmailDomains reads REGISTRATION_ALLOWED_DOMAINS, a comma separated list
+func allowedEmailDomains() []string {
+	var domains []string
+	for _, domain := range strings.Split(os.Getenv("REGISTRATION_ALLOWED_DOMAINS"), ",") {
+		if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+	return domains
+}
+
+func isEmailDomainAllowed(email string) bool {
+	at := strings.LastIndex(email, "@")
+	if at < 1 || at == len(email)-1 {
+		return false
+	}
+	domain := strings.ToLower(email[at+1:])
+	for _, allowed := range allowedEmailDomains() {
+		if domain == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// RegisterUser creates a user subject to REGISTRATION_MODE. An invite code is
+// required in invite-only mode and optional otherwise; when one is given it
+// is redeemed and its roles granted in the same transaction as the user is
+// created, so a failed registration doesn't use up the invite. An
+// organization invitation stands in for an invite code or an allowed email
+// domain; the user takes the invited email address and joins the org.
+// Anyone can type an allowed address, so users let in by their email domain
+// stay pending-verification until VerifyEmail confirms it.
+func RegisterUser(ctx context.Context, reg Registration) (*models.User, error) {
+	if reg.OrgInvitation != "" {
+		invitation, err := GetOrgInvitation(reg.OrgInvitation)
+		if err != nil {
+			return nil, err
+		}
+		if reg.Email == "" {
+			reg.Email = invitation.Email
+		} else if !strings.EqualFold(reg.Email, invitation.Email) {
+			return nil, ErrOrgInvitationEmail
+		}
+	}
+
+	status := UserActive
+	switch RegistrationMode() {
+	case RegistrationOpen:
+	case RegistrationDisabled:
+		return nil, ErrRegistrationDisabled
+	case RegistrationInviteOnly:
+		if reg.InviteCode == "" && reg.OrgInvitation == "" {
+			return nil, ErrInviteRequired
+		}
+	case RegistrationDomainAllowlist:
+		if reg.OrgInvitation != "" {
+			break
+		}
+		if reg.Email == "" {
+			return nil, ErrEmailRequired
+		}
+		if !isEmailDomainAllowed(reg.Email) {
+			return nil, ErrEmailDomainNotAllowed
+		}
+		status = UserPendingVerification
+	default:
+		// Unknown modes fail closed
+		return nil, ErrRegistrationDisabled
+	}
+
+	userEntry, err := newUserEntry(ctx, reg.Username, reg.Password, reg.Email)
+	if err != nil {
+		return nil, err
+	}
+	userEntry.Status = status
+
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		var roles []string
+		var grantedBy string
+		if reg.InviteCode != "" {
+			invite, err := redeemInvite(tx, reg.InviteCode)
+			if err != nil {
+				return err
+			}
+			roles = InviteRoles(invite)
+			grantedBy = invite.CreatedBy
+		}
+
+		err := insertUser(tx, userEntry)
+		if err != nil {
+			return err
+		}
+
+		for _, role := range roles {
+			err = tx.Create(&models.Roles{Username: userEntry.Username, Role: role, GrantedBy: grantedBy}).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		if reg.OrgInvitation != "" {
+			_, err = acceptOrgInvitation(tx, reg.OrgInvitation, userEntry.Username, userEntry.Email)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return userEntry, nil
+}
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestRegisterUser_Disabled(t *testing.T) {
+	t.Setenv("REGISTRATION_MODE", RegistrationDisabled)
+
+	user, err := RegisterUser(context.Background(), Registration{Username: "testuser", Password: "password123"})
+	if !errors.Is(err, ErrRegistrationDisabled) {
+		t.Errorf("RegisterUser() error = %v, want %v", err, ErrRegistrationDisabled)
+	}
+
+	if user != nil {
+		t.Error("RegisterUser() should return nil user when registration is disabled")
+	}
+}
+
+func TestRegisterUser_UnknownModeFailsClosed(t *testing.T) {
+	t.Setenv("REGISTRATION_MODE", "invite")
+
+	_, err := RegisterUser(context.Background(), Registration{Username: "testuser", Password: "password123"})
+	if !errors.Is(err, ErrRegistrationDisabled) {
+		t.Errorf("RegisterUser() error = %v, want %v", err, ErrRegistrationDisabled)
+	}
+}
+
+func TestRegisterUser_InviteRequired(t *testing.T) {
+	t.Setenv("REGISTRATION_MODE", RegistrationInviteOnly)
+
+	_, err := RegisterUser(context.Background(), Registration{Username: "testuser", Password: "password123"})
+	if !errors.Is(err, ErrInviteRequired) {
+		t.Errorf("RegisterUser() error = %v, want %v", err, ErrInviteRequired)
+	}
+}
+
+func TestRegisterUser_EmailDomain(t *testing.T) {
+	t.Setenv("REGISTRATION_MODE", RegistrationDomainAllowlist)
+	t.Setenv("REGISTRATION_ALLOWED_DOMAINS", "example.com, corp.example.org")
+
+	tests := []struct {
+		name  string
+		email string
+		want  error
+	}{
+		{"missing email", "", ErrEmailRequired},
+		{"other domain", "user@evil.com", ErrEmailDomainNotAllowed},
+		{"subdomain of allowed domain", "user@sub.example.com", ErrEmailDomainNotAllowed},
+		{"no domain", "user@", ErrEmailDomainNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := RegisterUser(context.Background(), Registration{Username: "testuser", Password: "password123", Email: tt.email})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("RegisterUser() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	if !isEmailDomainAllowed("User@Corp.Example.org") {
+		t.Error("isEmailDomainAllowed() should ignore case")
+	}
+}
+
+func TestRegisterUser_EmailDomainPendingVerification(t *testing.T) {
+	t.Setenv("REGISTRATION_MODE", RegistrationDomainAllowlist)
+	t.Setenv("REGISTRATION_ALLOWED_DOMAINS", "example.com")
+
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "users"`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "testuser", sqlmock.AnyArg(), sqlmock.AnyArg(), "user@example.com", nil, "", UserPendingVerification, "", nil, "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	user, err := RegisterUser(context.Background(), Registration{Username: "testuser", Password: "password123", Email: "user@example.com"})
+	if err != nil {
+		t.Fatalf("RegisterUser() error = %v", err)
+	}
+	if user.Status != UserPendingVerification {
+		t.Errorf("RegisterUser() status = %q, want %q", user.Status, UserPendingVerification)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestRegisterUser_WithInvite(t *testing.T) {
+	t.Setenv("REGISTRATION_MODE", RegistrationInviteOnly)
+
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	inviteRows := sqlmock.NewRows([]string{"id", "code_hash", "max_uses", "uses", "expires_at", "roles"}).
+		AddRow(7, hashInviteCode("invitecode"), 5, 1, time.Now().Add(time.Hour), "editor,viewer")
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "invites" WHERE code_hash = $1 AND "invites"."deleted_at" IS NULL ORDER BY "invites"."id" LIMIT $2 FOR UPDATE`)).
+		WithArgs(hashInviteCode("invitecode"), 1).
+		WillReturnRows(inviteRows)
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "invites" SET "uses"=uses + 1`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "users"`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "testuser", sqlmock.AnyArg(), sqlmock.AnyArg(), "", nil, "", UserActive, "", nil, "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "roles"`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "testuser", "editor", "", nil, "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "roles"`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "testuser", "viewer", "", nil, "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	mock.ExpectCommit()
+
+	user, err := RegisterUser(context.Background(), Registration{Username: "testuser", Password: "password123", InviteCode: "invitecode"})
+	if err != nil {
+		t.Fatalf("RegisterUser() error = %v", err)
+	}
+
+	if user.Username != "testuser" {
+		t.Errorf("RegisterUser() username = %v, want testuser", user.Username)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestRegisterUser_InviteUsedUp(t *testing.T) {
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	inviteRows := sqlmock.NewRows([]string{"id", "code_hash", "max_uses", "uses", "expires_at", "roles"}).
+		AddRow(7, hashInviteCode("invitecode"), 1, 1, nil, "")
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "invites" WHERE code_hash = $1`)).
+		WillReturnRows(inviteRows)
+	mock.ExpectRollback()
+
+	_, err := RegisterUser(context.Background(), Registration{Username: "testuser", Password: "password123", InviteCode: "invitecode"})
+	if !errors.Is(err, ErrInviteInvalid) {
+		t.Errorf("RegisterUser() error = %v, want %v", err, ErrInviteInvalid)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestRegisterUser_InviteExpired(t *testing.T) {
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	inviteRows := sqlmock.NewRows([]string{"id", "code_hash", "max_uses", "uses", "expires_at", "roles"}).
+		AddRow(7, hashInviteCode("invitecode"), 0, 0, time.Now().Add(-time.Hour), "")
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "invites" WHERE code_hash = $1`)).
+		WillReturnRows(inviteRows)
+	mock.ExpectRollback()
+
+	_, err := RegisterUser(context.Background(), Registration{Username: "testuser", Password: "password123", InviteCode: "invitecode"})
+	if !errors.Is(err, ErrInviteInvalid) {
+		t.Errorf("RegisterUser() error = %v, want %v", err, ErrInviteInvalid)
+	}
+}
+
+func TestCreateInvite(t *testing.T) {
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	expectRoleDefinition(mock, "editor", false)
+	expectRoleDefinition(mock, "viewer", true)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "invites"`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "app:billing", 3, 0, sqlmock.AnyArg(), "editor,viewer").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	code, invite, err := CreateInvite("app:billing", 3, 24*time.Hour, []string{"editor", " viewer ", ""})
+	if err != nil {
+		t.Fatalf("CreateInvite() error = %v", err)
+	}
+
+	if len(code) != 32 {
+		t.Errorf("CreateInvite() code length = %v, want 32", len(code))
+	}
+
+	if invite.CodeHash != hashInviteCode(code) {
+		t.Error("CreateInvite() should store the hash of the code")
+	}
+
+	if invite.ExpiresAt == nil {
+		t.Error("CreateInvite() should set an expiry")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,553 @@
+package services
+
+import (
+	"auth-api-go/models"
+	"auth-api-go/redis"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// maxRelationDepth bounds how far checks follow usersets and computed
+// relations, so a badly configured namespace can't recurse forever.
+const maxRelationDepth = 25
+
+// maxListObjects caps how many candidate objects ListObjects checks
+const maxListObjects = 1000
+
+// maxReachableObjects caps how many objects ListObjects walks through, in any
+// namespace, while looking for candidates reachable from the user
+const maxReachableObjects = 10000
+
+// relationCacheTTL is how long a check result is cached. Any write bumps the
+// revision in the cache key, so this only bounds Redis memory.
+const relationCacheTTL = 10 * time.Minute
+
+var (
+	ErrObjectInvalid       = errors.New("objects must look like namespace:id")
+	ErrNamespaceInvalid    = errors.New("invalid namespace configuration")
+	ErrNamespaceNotFound   = errors.New("namespace is not configured")
+	ErrRelationUndefined   = errors.New("relation is not defined in the namespace")
+	ErrRelationTooDeep     = errors.New("relation check is nested too deeply")
+	ErrRelationTupleExists = errors.New("relation tuple already exists")
+	ErrRelationTupleAbsent = errors.New("relation tuple not found")
+)
+
+// TupleToUserset follows Tupleset to other objects, e.g. a document's
+// parent folder, and checks ComputedUserset there, e.g. the folder's viewers.
+type TupleToUserset struct {
+	Tupleset        string `json:"tupleset"`
+	ComputedUserset string `json:"computedUserset"`
+}
+
+// RelationConfig defines one relation. Users hold it through tuples written
+// for it directly, through any relation in Union on the same object (e.g.
+// editors are viewers), and through TupleToUserset.
+type RelationConfig struct {
+	Union          []string         `json:"union,omitempty"`
+	TupleToUserset []TupleToUserset `json:"tupleToUserset,omitempty"`
+}
+
+type NamespaceConfig struct {
+	Relations map[string]RelationConfig `json:"relations"`
+}
+
+func validateNamespaceConfig(config NamespaceConfig) error {
+	if len(config.Relations) == 0 {
+		return fmt.Errorf("%w: at least one relation is required", ErrNamespaceInvalid)
+	}
+	for name, relation := range config.Relations {
+		for _, computed := range relation.Union {
+			if _, ok := config.Relations[computed]; !ok {
+				return fmt.Errorf("%w: %s unions unknown relation %s", ErrNamespaceInvalid, name, computed)
+			}
+		}
+		for _, ttu := range relation.TupleToUserset {
+			if _, ok := config.Relations[ttu.Tupleset]; !ok || ttu.ComputedUserset == "" {
+				return fmt.Errorf("%w: %s follows unknown relation %s", ErrNamespaceInvalid, name, ttu.Tupleset)
+			}
+		}
+	}
+	return nil
+}
+
+// splitObject returns the namespace of an object like "document:readme"
+func splitObject(object string) (string, error) {
+	namespace, id, found := strings.Cut(object, ":")
+	if !found || namespace == "" || id == "" || strings.Contains(object, "#") {
+		return "", ErrObjectInvalid
+	}
+	return namespace, nil
+}
+
+// splitUserset separates a subject like "group:eng#member" into its object
+// and relation. Plain usernames aren't usersets.
+func splitUserset(subject string) (string, string, bool) {
+	object, relation, found := strings.Cut(subject, "#")
+	if !found {
+		return "", "", false
+	}
+	return object, relation, true
+}
+
+func loadNamespaces() (map[string]NamespaceConfig, error) {
+	var rows []models.RelationNamespace
+	result := models.DB.Find(&rows)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	namespaces := make(map[string]NamespaceConfig)
+	for _, row := range rows {
+		var config NamespaceConfig
+		if err := json.Unmarshal([]byte(row.Config), &config); err != nil {
+			return nil, fmt.Errorf("error decoding namespace %s: %v", row.Name, err)
+		}
+		namespaces[row.Name] = config
+	}
+	return namespaces, nil
+}
+
+func GetNamespaces() (map[string]NamespaceConfig, error) {
+	return loadNamespaces()
+}
+
+// SaveNamespace creates or replaces the configuration for name
+func SaveNamespace(name string, config NamespaceConfig) error {
+	if name == "" || strings.ContainsAny(name, ":#") {
+		return fmt.Errorf("%w: name can't be empty or contain : or #", ErrNamespaceInvalid)
+	}
+	if err := validateNamespaceConfig(config); err != nil {
+		return err
+	}
+
+	encoded, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	namespace := models.RelationNamespace{Name: name}
+	err = models.DB.Where(models.RelationNamespace{Name: name}).
+		Assign(models.RelationNamespace{Config: string(encoded)}).
+		FirstOrCreate(&namespace).Error
+	if err != nil {
+		return err
+	}
+
+	return bumpRelationRevision()
+}
+
+// validateRelation checks object's namespace is configured with relation
+func validateRelation(namespaces map[string]NamespaceConfig, object string, relation string) error {
+	namespace, err := splitObject(object)
+	if err != nil {
+		return err
+	}
+	config, ok := namespaces[namespace]
+	if !ok {
+		return ErrNamespaceNotFound
+	}
+	if _, ok := config.Relations[relation]; !ok {
+		return ErrRelationUndefined
+	}
+	return nil
+}
+
+func validateTuple(object string, relation string, subject string) error {
+	namespaces, err := loadNamespaces()
+	if err != nil {
+		return err
+	}
+	if err := validateRelation(namespaces, object, relation); err != nil {
+		return err
+	}
+
+	if subject == "" {
+		return ErrObjectInvalid
+	}
+	if subjectObject, subjectRelation, isUserset := splitUserset(subject); isUserset {
+		return validateRelation(namespaces, subjectObject, subjectRelation)
+	}
+	return nil
+}
+
+// WriteTuple records that subject has relation to object
+func WriteTuple(object string, relation string, subject string) error {
+	if err := validateTuple(object, relation, subject); err != nil {
+		return err
+	}
+
+	tupleEntry := &models.RelationTuple{
+		Object:   object,
+		Relation: relation,
+		Subject:  subject,
+	}
+
+	err := models.DB.Create(tupleEntry).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrRelationTupleExists
+	}
+	if err != nil {
+		return err
+	}
+
+	return bumpRelationRevision()
+}
+
+// DeleteTuple removes the row outright so it can be written again later
+func DeleteTuple(object string, relation string, subject string) error {
+	result := models.DB.Unscoped().
+		Where("object = ? AND relation = ? AND subject = ?", object, relation, subject).
+		Delete(&models.RelationTuple{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRelationTupleAbsent
+	}
+
+	return bumpRelationRevision()
+}
+
+func readTupleSubjects(object string, relation string) ([]string, error) {
+	var subjects []string
+	result := models.DB.Model(&models.RelationTuple{}).
+		Where("object = ? AND relation = ?", object, relation).
+		Pluck("subject", &subjects)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return subjects, nil
+}
+
+func readTupleObjects(subjects []string) ([]string, error) {
+	var objects []string
+	result := models.DB.Model(&models.RelationTuple{}).
+		Distinct().
+		Where("subject IN ?", subjects).
+		Order("object").
+		Pluck("object", &objects)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return objects, nil
+}
+
+// relationGraph resolves relations over the tuples returned by subjects, and
+// walks them backwards through objects, which returns every object with a
+// tuple for any of the given subjects
+type relationGraph struct {
+	namespaces map[string]NamespaceConfig
+	subjects   func(object string, relation string) ([]string, error)
+	objects    func(subjects []string) ([]string, error)
+}
+
+func (g *relationGraph) relationConfig(object string, relation string) (RelationConfig, bool) {
+	namespace, err := splitObject(object)
+	if err != nil {
+		return RelationConfig{}, false
+	}
+	config, ok := g.namespaces[namespace].Relations[relation]
+	return config, ok
+}
+
+func (g *relationGraph) check(object string, relation string, username string, depth int, visited map[string]bool) (bool, error) {
+	if depth > maxRelationDepth {
+		return false, ErrRelationTooDeep
+	}
+
+	// A node already being or been checked can't add anything new
+	node := object + "#" + relation
+	if visited[node] {
+		return false, nil
+	}
+	visited[node] = true
+
+	config, ok := g.relationConfig(object, relation)
+	if !ok {
+		return false, nil
+	}
+
+	subjects, err := g.subjects(object, relation)
+	if err != nil {
+		return false, err
+	}
+	for _, subject := range subjects {
+		if subject == username {
+			return true, nil
+		}
+		if subjectObject, subjectRelation, isUserset := splitUserset(subject); isUserset {
+			found, err := g.check(subjectObject, subjectRelation, username, depth+1, visited)
+			if found || err != nil {
+				return found, err
+			}
+		}
+	}
+
+	for _, computed := range config.Union {
+		found, err := g.check(object, computed, username, depth+1, visited)
+		if found || err != nil {
+			return found, err
+		}
+	}
+
+	for _, ttu := range config.TupleToUserset {
+		targets, err := g.subjects(object, ttu.Tupleset)
+		if err != nil {
+			return false, err
+		}
+		for _, target := range targets {
+			targetObject, _, _ := strings.Cut(target, "#")
+			found, err := g.check(targetObject, ttu.ComputedUserset, username, depth+1, visited)
+			if found || err != nil {
+				return found, err
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// ExpandNode is the tree of who holds a relation: users with a direct tuple,
+// plus a child for every userset, computed relation or followed tuple.
+type ExpandNode struct {
+	Object   string        `json:"object"`
+	Relation string        `json:"relation"`
+	Users    []string      `json:"users"`
+	Children []*ExpandNode `json:"children,omitempty"`
+}
+
+func (g *relationGraph) expand(object string, relation string, depth int, visited map[string]bool) (*ExpandNode, error) {
+	if depth > maxRelationDepth {
+		return nil, ErrRelationTooDeep
+	}
+
+	expanded := &ExpandNode{Object: object, Relation: relation, Users: []string{}}
+	node := object + "#" + relation
+	if visited[node] {
+		return expanded, nil
+	}
+	visited[node] = true
+
+	config, ok := g.relationConfig(object, relation)
+	if !ok {
+		return expanded, nil
+	}
+
+	addChild := func(childObject string, childRelation string) error {
+		child, err := g.expand(childObject, childRelation, depth+1, visited)
+		if err != nil {
+			return err
+		}
+		expanded.Children = append(expanded.Children, child)
+		return nil
+	}
+
+	subjects, err := g.subjects(object, relation)
+	if err != nil {
+		return nil, err
+	}
+	for _, subject := range subjects {
+		if subjectObject, subjectRelation, isUserset := splitUserset(subject); isUserset {
+			if err := addChild(subjectObject, subjectRelation); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		expanded.Users = append(expanded.Users, subject)
+	}
+
+	for _, computed := range config.Union {
+		if err := addChild(object, computed); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, ttu := range config.TupleToUserset {
+		targets, err := g.subjects(object, ttu.Tupleset)
+		if err != nil {
+			return nil, err
+		}
+		for _, target := range targets {
+			targetObject, _, _ := strings.Cut(target, "#")
+			if err := addChild(targetObject, ttu.ComputedUserset); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return expanded, nil
+}
+
+// reachable returns the objects in namespace that are linked to username by a
+// chain of tuples: written for the user, for a userset on a linked object, or
+// pointing at a linked object. Only those can pass check, so they're the
+// candidates ListObjects needs. It reports whether the walk was cut short.
+func (g *relationGraph) reachable(namespace string, username string) ([]string, bool, error) {
+	reached := map[string]bool{}
+	candidates := []string{}
+	subjects := []string{username}
+
+	for depth := 0; len(subjects) > 0; depth++ {
+		if depth > maxRelationDepth {
+			return candidates, true, nil
+		}
+
+		objects, err := g.objects(subjects)
+		if err != nil {
+			return nil, false, err
+		}
+
+		subjects = nil
+		for _, object := range objects {
+			if reached[object] {
+				continue
+			}
+			if len(reached) == maxReachableObjects {
+				return candidates, true, nil
+			}
+			reached[object] = true
+
+			objectNamespace, err := splitObject(object)
+			if err != nil {
+				continue
+			}
+			if objectNamespace == namespace {
+				if len(candidates) == maxListObjects {
+					return candidates, true, nil
+				}
+				candidates = append(candidates, object)
+			}
+
+			// Tuple-to-userset targets name the object alone, usersets
+			// name one of its relations
+			subjects = append(subjects, object)
+			relations := make([]string, 0, len(g.namespaces[objectNamespace].Relations))
+			for relation := range g.namespaces[objectNamespace].Relations {
+				relations = append(relations, relation)
+			}
+			sort.Strings(relations)
+			for _, relation := range relations {
+				subjects = append(subjects, object+"#"+relation)
+			}
+		}
+	}
+
+	return candidates, false, nil
+}
+
+func newRelationGraph(object string, relation string) (*relationGraph, error) {
+	namespaces, err := loadNamespaces()
+	if err != nil {
+		return nil, err
+	}
+	if err := validateRelation(namespaces, object, relation); err != nil {
+		return nil, err
+	}
+	return &relationGraph{namespaces: namespaces, subjects: readTupleSubjects, objects: readTupleObjects}, nil
+}
+
+// CheckRelation reports whether username has relation to object, directly or
+// through usersets and computed relations. Results are cached in Redis under
+// the current revision, so any tuple or namespace write invalidates them.
+func CheckRelation(object string, relation string, username string) (bool, error) {
+	graph, err := newRelationGraph(object, relation)
+	if err != nil {
+		return false, err
+	}
+
+	ctx := context.Background()
+	cacheKey := ""
+	if revision, err := relationRevision(); err == nil {
+		cacheKey = "relation-check:" + revision + ":" + object + "#" + relation + "@" + username
+		if cached, err := redis.REDIS.Get(ctx, cacheKey).Result(); err == nil {
+			return cached == "1", nil
+		}
+	}
+
+	found, err := graph.check(object, relation, username, 0, make(map[string]bool))
+	if err != nil {
+		return false, err
+	}
+
+	if cacheKey != "" {
+		value := "0"
+		if found {
+			value = "1"
+		}
+		if err := redis.REDIS.Set(ctx, cacheKey, value, relationCacheTTL).Err(); err != nil {
+			fmt.Println("error with redis set", err.Error())
+		}
+	}
+
+	return found, nil
+}
+
+// ExpandRelation returns the tree of everyone holding relation to object
+func ExpandRelation(object string, relation string) (*ExpandNode, error) {
+	graph, err := newRelationGraph(object, relation)
+	if err != nil {
+		return nil, err
+	}
+	return graph.expand(object, relation, 0, make(map[string]bool))
+}
+
+// ListObjects returns the objects in namespace that username has relation
+// to. Candidates come from walking tuples back from the user, and at most
+// maxListObjects of them are checked; truncated reports when some were left
+// out.
+func ListObjects(namespace string, relation string, username string) ([]string, bool, error) {
+	graph, err := newRelationGraph(namespace+":*", relation)
+	if err != nil {
+		return nil, false, err
+	}
+
+	candidates, truncated, err := graph.reachable(namespace, username)
+	if err != nil {
+		return nil, false, err
+	}
+
+	objects := []string{}
+	for _, object := range candidates {
+		found, err := graph.check(object, relation, username, 0, make(map[string]bool))
+		if err != nil {
+			return nil, false, err
+		}
+		if found {
+			objects = append(objects, object)
+		}
+	}
+	sort.Strings(objects)
+
+	return objects, truncated, nil
+}
+
+// relationRevision returns the counter bumped by every relation write
+func relationRevision() (string, error) {
+	ctx := context.Background()
+	revision, err := redis.REDIS.Get(ctx, "relation-revision").Result()
+	if err != nil {
+		if err.Error() == "redis: nil" {
+			return "0", nil
+		}
+		fmt.Println("error with redis get", err.Error())
+		return "", fmt.Errorf("error with redis get: %v", err)
+	}
+	return revision, nil
+}
+
+func bumpRelationRevision() error {
+	ctx := context.Background()
+	err := redis.REDIS.Incr(ctx, "relation-revision").Err()
+	if err != nil {
+		fmt.Println("error with redis incr", err.Error())
+		return fmt.Errorf("error with redis incr: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,315 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var documentNamespaces = map[string]NamespaceConfig{
+	"document": {Relations: map[string]RelationConfig{
+		"parent": {},
+		"owner":  {},
+		"editor": {Union: []string{"owner"}},
+		"viewer": {
+			Union:          []string{"editor"},
+			TupleToUserset: []TupleToUserset{{Tupleset: "parent", ComputedUserset: "viewer"}},
+		},
+	}},
+	"folder": {Relations: map[string]RelationConfig{
+		"viewer": {},
+	}},
+	"group": {Relations: map[string]RelationConfig{
+		"member": {},
+	}},
+}
+
+// newTestRelationGraph serves tuples from memory, keyed by "object#relation"
+func newTestRelationGraph(tuples map[string][]string) *relationGraph {
+	return &relationGraph{
+		namespaces: documentNamespaces,
+		subjects: func(object string, relation string) ([]string, error) {
+			return tuples[object+"#"+relation], nil
+		},
+		objects: func(subjects []string) ([]string, error) {
+			var objects []string
+			for node, nodeSubjects := range tuples {
+				object, _, _ := strings.Cut(node, "#")
+				for _, subject := range nodeSubjects {
+					if slices.Contains(subjects, subject) && !slices.Contains(objects, object) {
+						objects = append(objects, object)
+					}
+				}
+			}
+			sort.Strings(objects)
+			return objects, nil
+		},
+	}
+}
+
+func TestRelationGraphCheck(t *testing.T) {
+	graph := newTestRelationGraph(map[string][]string{
+		"document:readme#owner":  {"alice"},
+		"document:readme#parent": {"folder:docs"},
+		"folder:docs#viewer":     {"group:eng#member"},
+		"group:eng#member":       {"bob"},
+		// A cycle through usersets must not recurse forever
+		"group:loop#member": {"group:loop#member"},
+	})
+
+	tests := []struct {
+		name     string
+		object   string
+		relation string
+		username string
+		want     bool
+	}{
+		{"direct", "document:readme", "owner", "alice", true},
+		{"computed union", "document:readme", "viewer", "alice", true},
+		{"tuple to userset", "document:readme", "viewer", "bob", true},
+		{"not granted", "document:readme", "editor", "bob", false},
+		{"unknown user", "document:readme", "viewer", "carol", false},
+		{"cycle", "group:loop", "member", "alice", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := graph.check(tt.object, tt.relation, tt.username, 0, make(map[string]bool))
+			if err != nil {
+				t.Fatalf("check() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("check() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRelationGraphReachable(t *testing.T) {
+	graph := newTestRelationGraph(map[string][]string{
+		"document:readme#owner":   {"alice"},
+		"document:roadmap#parent": {"folder:docs"},
+		"document:secret#owner":   {"carol"},
+		"folder:docs#viewer":      {"group:eng#member"},
+		"group:eng#member":        {"bob"},
+	})
+
+	tests := []struct {
+		name     string
+		username string
+		want     []string
+	}{
+		{"direct", "alice", []string{"document:readme"}},
+		{"through userset and parent", "bob", []string{"document:roadmap"}},
+		{"nothing linked", "dave", []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, truncated, err := graph.reachable("document", tt.username)
+			if err != nil {
+				t.Fatalf("reachable() error = %v", err)
+			}
+			if truncated {
+				t.Errorf("reachable() truncated = true, want false")
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("reachable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRelationGraphExpand(t *testing.T) {
+	graph := newTestRelationGraph(map[string][]string{
+		"document:readme#owner":  {"alice"},
+		"document:readme#editor": {"group:eng#member"},
+		"group:eng#member":       {"bob"},
+	})
+
+	tree, err := graph.expand("document:readme", "editor", 0, make(map[string]bool))
+	if err != nil {
+		t.Fatalf("expand() error = %v", err)
+	}
+
+	if len(tree.Children) != 2 {
+		t.Fatalf("expand() children = %+v, want 2", tree.Children)
+	}
+	if got := tree.Children[0]; got.Object != "group:eng" || !reflect.DeepEqual(got.Users, []string{"bob"}) {
+		t.Errorf("expand() userset child = %+v", got)
+	}
+	if got := tree.Children[1]; got.Relation != "owner" || !reflect.DeepEqual(got.Users, []string{"alice"}) {
+		t.Errorf("expand() union child = %+v", got)
+	}
+}
+
+func TestValidateNamespaceConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config NamespaceConfig
+		valid  bool
+	}{
+		{"valid", documentNamespaces["document"], true},
+		{"empty", NamespaceConfig{}, false},
+		{"unknown union", NamespaceConfig{Relations: map[string]RelationConfig{"viewer": {Union: []string{"editor"}}}}, false},
+		{"unknown tupleset", NamespaceConfig{Relations: map[string]RelationConfig{
+			"viewer": {TupleToUserset: []TupleToUserset{{Tupleset: "parent", ComputedUserset: "viewer"}}},
+		}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateNamespaceConfig(tt.config)
+			if tt.valid && err != nil {
+				t.Errorf("validateNamespaceConfig() error = %v", err)
+			}
+			if !tt.valid && !errors.Is(err, ErrNamespaceInvalid) {
+				t.Errorf("validateNamespaceConfig() error = %v, want ErrNamespaceInvalid", err)
+			}
+		})
+	}
+}
+
+func expectNamespaces(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "relation_namespaces" WHERE "relation_namespaces"."deleted_at" IS NULL`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "config"}).
+			AddRow(1, "document", `{"relations":{"owner":{},"viewer":{"union":["owner"]}}}`))
+}
+
+func TestWriteTuple(t *testing.T) {
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+	redisMock := setupMockRedis(t)
+
+	expectNamespaces(mock)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "relation_tuples"`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, "document:readme", "owner", "alice").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+	redisMock.ExpectIncr("relation-revision").SetVal(2)
+
+	if err := WriteTuple("document:readme", "owner", "alice"); err != nil {
+		t.Errorf("WriteTuple() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+	if err := redisMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled redis expectations: %v", err)
+	}
+}
+
+func TestWriteTuple_UndefinedRelation(t *testing.T) {
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	expectNamespaces(mock)
+
+	err := WriteTuple("document:readme", "editor", "alice")
+	if !errors.Is(err, ErrRelationUndefined) {
+		t.Errorf("WriteTuple() error = %v, want ErrRelationUndefined", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestCheckRelation_Cached(t *testing.T) {
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+	redisMock := setupMockRedis(t)
+
+	expectNamespaces(mock)
+	redisMock.ExpectGet("relation-revision").SetVal("2")
+	redisMock.ExpectGet("relation-check:2:document:readme#viewer@alice").SetVal("1")
+
+	allowed, err := CheckRelation("document:readme", "viewer", "alice")
+	if err != nil {
+		t.Fatalf("CheckRelation() error = %v", err)
+	}
+	if !allowed {
+		t.Errorf("CheckRelation() = false, want true")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+	if err := redisMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled redis expectations: %v", err)
+	}
+}
+
+func TestCheckRelation_Uncached(t *testing.T) {
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+	redisMock := setupMockRedis(t)
+
+	expectNamespaces(mock)
+	redisMock.ExpectGet("relation-revision").RedisNil()
+	redisMock.ExpectGet("relation-check:0:document:readme#viewer@alice").RedisNil()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "subject" FROM "relation_tuples" WHERE (object = $1 AND relation = $2)`)).
+		WithArgs("document:readme", "viewer").
+		WillReturnRows(sqlmock.NewRows([]string{"subject"}))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "subject" FROM "relation_tuples" WHERE (object = $1 AND relation = $2)`)).
+		WithArgs("document:readme", "owner").
+		WillReturnRows(sqlmock.NewRows([]string{"subject"}).AddRow("alice"))
+	redisMock.ExpectSet("relation-check:0:document:readme#viewer@alice", "1", relationCacheTTL).SetVal("OK")
+
+	allowed, err := CheckRelation("document:readme", "viewer", "alice")
+	if err != nil {
+		t.Fatalf("CheckRelation() error = %v", err)
+	}
+	if !allowed {
+		t.Errorf("CheckRelation() = false, want true")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+	if err := redisMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled redis expectations: %v", err)
+	}
+}
+
+func TestListObjects(t *testing.T) {
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	expectNamespaces(mock)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT DISTINCT "object" FROM "relation_tuples" WHERE subject IN ($1) AND "relation_tuples"."deleted_at" IS NULL ORDER BY object`)).
+		WithArgs("alice").
+		WillReturnRows(sqlmock.NewRows([]string{"object"}).AddRow("document:readme"))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT DISTINCT "object" FROM "relation_tuples" WHERE subject IN ($1,$2,$3) AND "relation_tuples"."deleted_at" IS NULL ORDER BY object`)).
+		WithArgs("document:readme", "document:readme#owner", "document:readme#viewer").
+		WillReturnRows(sqlmock.NewRows([]string{"object"}))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "subject" FROM "relation_tuples" WHERE (object = $1 AND relation = $2)`)).
+		WithArgs("document:readme", "viewer").
+		WillReturnRows(sqlmock.NewRows([]string{"subject"}))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "subject" FROM "relation_tuples" WHERE (object = $1 AND relation = $2)`)).
+		WithArgs("document:readme", "owner").
+		WillReturnRows(sqlmock.NewRows([]string{"subject"}).AddRow("alice"))
+
+	objects, truncated, err := ListObjects("document", "viewer", "alice")
+	if err != nil {
+		t.Fatalf("ListObjects() error = %v", err)
+	}
+	if truncated {
+		t.Errorf("ListObjects() truncated = true, want false")
+	}
+	if !reflect.DeepEqual(objects, []string{"document:readme"}) {
+		t.Errorf("ListObjects() = %v, want [document:readme]", objects)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
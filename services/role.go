@@ -2,42 +2,223 @@ package services
 
 import (
 	"auth-api-go/models"
+	"errors"
+	"time"
 )
 
+// AdminRole is built in; holders can manage other users' roles
+const AdminRole = "admin"
+
+var ErrRoleNotSelfAssignable = errors.New("role can't be self-assigned")
+
+// IsRoleSelfAssignable reports whether users may give themselves role, as
+// set by the role's Assignable flag in the catalog. The admin role never is,
+// and neither is a role that inherits admin or any role that isn't
+// assignable, since holding it grants those too.
+func IsRoleSelfAssignable(role string) (bool, error) {
+	if role == AdminRole {
+		return false, nil
+	}
+
+	definition, err := GetRoleDefinition(role)
+	if err != nil {
+		return false, err
+	}
+	if !definition.Assignable {
+		return false, nil
+	}
+
+	parents, err := loadRoleInheritance()
+	if err != nil {
+		return false, err
+	}
+	if len(parents[role]) == 0 {
+		return true, nil
+	}
+
+	definitions, err := GetRoleDefinitions()
+	if err != nil {
+		return false, err
+	}
+	assignable := make(map[string]bool)
+	for _, definition := range definitions {
+		assignable[definition.Name] = definition.Assignable
+	}
+
+	for _, inherited := range resolveInheritedRoles([]models.Roles{{Role: role}}, parents)[1:] {
+		if inherited.Role == AdminRole || !assignable[inherited.Role] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// GetRolesByUsername returns username's deployment-wide effective roles
 func GetRolesByUsername(username string) ([]models.Roles, error) {
+	return GetOrgRolesByUsername(username, "")
+}
+
+// GetOrgRolesByUsername returns username's effective roles in org: the
+// unexpired ones granted directly, either deployment-wide or in org, then the
+// ones held through groups, followed by the ones inherited through either.
+// Roles granted in any other org are never included. Groups aren't tied to an
+// org, so their roles only count outside one.
+func GetOrgRolesByUsername(username string, org string) ([]models.Roles, error) {
 	var roles []models.Roles
-	result := models.DB.Find(&roles, "username = ?", username)
+	result := models.DB.Find(&roles, "username = ? AND (org = '' OR org = ?) AND (expires_at IS NULL OR expires_at > ?)", username, org, time.Now())
 	if result.Error != nil {
 		return nil, result.Error
 	}
-	return roles, nil
+
+	var groupGrants []models.GroupRole
+	if org == "" {
+		var err error
+		groupGrants, err = getGroupRoleGrants(username)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	held := make(map[string]bool)
+	for _, role := range roles {
+		held[role.Role] = true
+	}
+	for _, grant := range groupGrants {
+		if held[grant.Role] {
+			continue
+		}
+		held[grant.Role] = true
+		roles = append(roles, models.Roles{Username: username, Role: grant.Role, Group: grant.GroupName})
+	}
+
+	if len(roles) == 0 {
+		return roles, nil
+	}
+
+	parents, err := loadRoleInheritance()
+	if err != nil {
+		return nil, err
+	}
+	return resolveInheritedRoles(roles, parents), nil
 }
 
-func RoleCheck(roleToCheck string, username string) (bool, error) {
-	roles, err := GetRolesByUsername(username)
+// GetRoleGrant returns the entry that gives username roleToCheck, or nil when
+// they don't hold it. Its InheritedFrom and Group tell direct grants apart
+// from inherited and group ones.
+func GetRoleGrant(roleToCheck string, username string) (*models.Roles, error) {
+	return GetOrgRoleGrant(roleToCheck, username, "")
+}
+
+// GetOrgRoleGrant is GetRoleGrant for the roles username holds in org. When
+// the role is granted both deployment-wide and in org, the org's grant wins.
+func GetOrgRoleGrant(roleToCheck string, username string, org string) (*models.Roles, error) {
+	roles, err := GetOrgRolesByUsername(username, org)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
-	for _, role := range roles {
-		if role.Role == roleToCheck {
-			return true, nil
+	var grant *models.Roles
+	for i, role := range roles {
+		if role.Role != roleToCheck {
+			continue
+		}
+		if org != "" && role.Org == org {
+			return &roles[i], nil
+		}
+		if grant == nil {
+			grant = &roles[i]
 		}
 	}
 
-	return false, nil
+	return grant, nil
+}
+
+func RoleCheck(roleToCheck string, username string) (bool, error) {
+	grant, err := GetRoleGrant(roleToCheck, username)
+	if err != nil {
+		return false, err
+	}
+	return grant != nil, nil
 }
 
+// AddRole grants role to username. The role has to be defined in the catalog.
 func AddRole(username string, role string) error {
+	return GrantRole(username, role, "", 0)
+}
+
+// GrantRole grants role to username on behalf of grantedBy. A positive
+// expiresIn makes the grant temporary; RoleCheck ignores it once it lapses
+// and the role reaper deletes it.
+func GrantRole(username string, role string, grantedBy string, expiresIn time.Duration) error {
+	return GrantOrgRole(username, role, "", grantedBy, expiresIn)
+}
+
+// GrantOrgRole is GrantRole for a role that only applies in org
+func GrantOrgRole(username string, role string, org string, grantedBy string, expiresIn time.Duration) error {
+	_, err := GetRoleDefinition(role)
+	if err != nil {
+		return err
+	}
+
 	roleEntry := &models.Roles{
-		Username: username,
-		Role:     role,
+		Username:  username,
+		Role:      role,
+		Org:       org,
+		GrantedBy: grantedBy,
+	}
+	if expiresIn > 0 {
+		expiresAt := time.Now().Add(expiresIn)
+		roleEntry.ExpiresAt = &expiresAt
 	}
 
-	_, err := models.DB.Create(roleEntry).Rows()
+	err = models.DB.Create(roleEntry).Error
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return rolesChanged(username)
+}
+
+// AssignOwnRole adds role in org for username on their own request, refusing
+// roles that aren't self-assignable.
+func AssignOwnRole(username string, org string, role string, expiresIn time.Duration) error {
+	isAssignable, err := IsRoleSelfAssignable(role)
+	if err != nil {
+		return err
+	}
+	if !isAssignable {
+		return ErrRoleNotSelfAssignable
+	}
+	return GrantOrgRole(username, role, org, username, expiresIn)
+}
+
+// RemoveRole revokes the deployment-wide role from username, ending their
+// session if tokens embed roles.
+func RemoveRole(username string, role string) error {
+	return RemoveOrgRole(username, role, "")
+}
+
+// RemoveOrgRole revokes role in org from username
+func RemoveOrgRole(username string, role string, org string) error {
+	result := models.DB.Where("username = ? AND role = ? AND org = ?", username, role, org).Delete(&models.Roles{})
+	if result.Error != nil {
+		return result.Error
+	}
+	return rolesChanged(username)
+}
+
+// RemoveOwnRole revokes role in org from username on their own request.
+// Users may only drop roles they could have given themselves.
+func RemoveOwnRole(username string, org string, role string) error {
+	isAssignable, err := IsRoleSelfAssignable(role)
+	if errors.Is(err, ErrRoleUndefined) {
+		return ErrRoleNotSelfAssignable
+	}
+	if err != nil {
+		return err
+	}
+	if !isAssignable {
+		return ErrRoleNotSelfAssignable
+	}
+	return RemoveOrgRole(username, role, org)
 }
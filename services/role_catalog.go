@@ -0,0 +1,137 @@
+package services
+
+import (
+	"auth-api-go/models"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRoleUndefined = errors.New("role is not defined in the catalog")
+	ErrRoleExists    = errors.New("role is already defined")
+	ErrRoleInUse     = errors.New("role is still granted to users")
+	ErrRoleBuiltIn   = errors.New("built-in roles can't be changed")
+)
+
+func GetRoleDefinitions() ([]models.RoleDefinition, error) {
+	var definitions []models.RoleDefinition
+	result := models.DB.Order("name").Find(&definitions)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return definitions, nil
+}
+
+// GetRoleDefinition returns ErrRoleUndefined when name isn't in the catalog
+func GetRoleDefinition(name string) (*models.RoleDefinition, error) {
+	var definition models.RoleDefinition
+	err := models.DB.Where("name = ?", name).First(&definition).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrRoleUndefined
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &definition, nil
+}
+
+func CreateRoleDefinition(name string, description string, createdBy string, assignable bool) (*models.RoleDefinition, error) {
+	if name == AdminRole {
+		return nil, ErrRoleBuiltIn
+	}
+
+	definitionEntry := &models.RoleDefinition{
+		Name:        name,
+		Description: description,
+		CreatedBy:   createdBy,
+		Assignable:  assignable,
+	}
+
+	err := models.DB.Create(definitionEntry).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return nil, ErrRoleExists
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return definitionEntry, nil
+}
+
+// UpdateRoleDefinition changes the fields that aren't nil
+func UpdateRoleDefinition(name string, description *string, assignable *bool) (*models.RoleDefinition, error) {
+	if name == AdminRole {
+		return nil, ErrRoleBuiltIn
+	}
+
+	definition, err := GetRoleDefinition(name)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{}
+	if description != nil {
+		updates["description"] = *description
+	}
+	if assignable != nil {
+		updates["assignable"] = *assignable
+	}
+	if len(updates) == 0 {
+		return definition, nil
+	}
+
+	err = models.DB.Model(definition).Updates(updates).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return definition, nil
+}
+
+// DeleteRoleDefinition removes a role, its permissions, its inheritance and
+// its group grants from the catalog. Roles still granted directly to someone
+// have to be revoked first.
+func DeleteRoleDefinition(name string) error {
+	if name == AdminRole {
+		return ErrRoleBuiltIn
+	}
+
+	var grants int64
+	err := models.DB.Model(&models.Roles{}).Where("role = ?", name).Count(&grants).Error
+	if err != nil {
+		return err
+	}
+	if grants > 0 {
+		return ErrRoleInUse
+	}
+
+	// Roles inheriting this one lose its permissions
+	err = roleHoldersChanged(name)
+	if err != nil {
+		return err
+	}
+
+	return models.DB.Transaction(func(tx *gorm.DB) error {
+		// Hard-deleted so the name's unique index lets it be defined again
+		result := tx.Unscoped().Where("name = ?", name).Delete(&models.RoleDefinition{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRoleUndefined
+		}
+
+		err := tx.Unscoped().Where("role = ?", name).Delete(&models.RolePermission{}).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Unscoped().Where("role = ? OR parent = ?", name, name).Delete(&models.RoleInheritance{}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Unscoped().Where("role = ?", name).Delete(&models.GroupRole{}).Error
+	})
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var roleDefinitionColumns = []string{"id", "created_at", "updated_at", "deleted_at", "name", "description", "created_by", "assignable"}
+
+func expectRoleDefinition(mock sqlmock.Sqlmock, name string, assignable bool) {
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "role_definitions" WHERE name = $1`)).
+		WithArgs(name, 1).
+		WillReturnRows(sqlmock.NewRows(roleDefinitionColumns).
+			AddRow(1, nil, nil, nil, name, "", "admin-user", assignable))
+}
+
+func TestGetRoleDefinition_Undefined(t *testing.T) {
+	mock, cleanup := setupRoleMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "role_definitions" WHERE name = $1`)).
+		WithArgs("edtior", 1).
+		WillReturnRows(sqlmock.NewRows(roleDefinitionColumns))
+
+	_, err := GetRoleDefinition("edtior")
+	if !errors.Is(err, ErrRoleUndefined) {
+		t.Errorf("GetRoleDefinition() error = %v, want %v", err, ErrRoleUndefined)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestAddRole_Undefined(t *testing.T) {
+	mock, cleanup := setupRoleMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "role_definitions" WHERE name = $1`)).
+		WithArgs("edtior", 1).
+		WillReturnRows(sqlmock.NewRows(roleDefinitionColumns))
+
+	err := AddRole("testuser", "edtior")
+	if !errors.Is(err, ErrRoleUndefined) {
+		t.Errorf("AddRole() error = %v, want %v", err, ErrRoleUndefined)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestCreateRoleDefinition_BuiltIn(t *testing.T) {
+	mock, cleanup := setupRoleMockDB(t)
+	defer cleanup()
+
+	_, err := CreateRoleDefinition(AdminRole, "", "admin-user", true)
+	if !errors.Is(err, ErrRoleBuiltIn) {
+		t.Errorf("CreateRoleDefinition() error = %v, want %v", err, ErrRoleBuiltIn)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestDeleteRoleDefinition_InUse(t *testing.T) {
+	mock, cleanup := setupRoleMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "roles" WHERE role = $1`)).
+		WithArgs("editor").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+
+	err := DeleteRoleDefinition("editor")
+	if !errors.Is(err, ErrRoleInUse) {
+		t.Errorf("DeleteRoleDefinition() error = %v, want %v", err, ErrRoleInUse)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestDeleteRoleDefinition_Success(t *testing.T) {
+	mock, cleanup := setupRoleMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "roles" WHERE role = $1`)).
+		WithArgs("editor").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "role_definitions" WHERE name = $1`)).
+		WithArgs("editor").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "role_permissions" WHERE role = $1`)).
+		WithArgs("editor").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "role_inheritances" WHERE role = $1 OR parent = $2`)).
+		WithArgs("editor", "editor").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "group_roles" WHERE role = $1`)).
+		WithArgs("editor").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err := DeleteRoleDefinition("editor")
+	if err != nil {
+		t.Errorf("DeleteRoleDefinition() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"auth-api-go/models"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRoleInheritanceCycle    = errors.New("role inheritance would form a cycle")
+	ErrRoleInheritanceExists   = errors.New("role already inherits from parent")
+	ErrRoleInheritanceNotFound = errors.New("role does not inherit from parent")
+)
+
+// loadRoleInheritance returns every role's direct parents. The table holds
+// one row per edge between catalog roles, so it is read whole.
+func loadRoleInheritance() (map[string][]string, error) {
+	var edges []models.RoleInheritance
+	result := models.DB.Find(&edges)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	parents := make(map[string][]string)
+	for _, edge := range edges {
+		parents[edge.Role] = append(parents[edge.Role], edge.Parent)
+	}
+	return parents, nil
+}
+
+// resolveInheritedRoles appends an entry for every role reachable from the
+// direct grants that isn't already held, noting which direct grant it came
+// through.
+func resolveInheritedRoles(direct []models.Roles, parents map[string][]string) []models.Roles {
+	held := make(map[string]bool)
+	for _, role := range direct {
+		held[role.Role] = true
+	}
+
+	roles := direct
+	for _, grant := range direct {
+		queue := append([]string{}, parents[grant.Role]...)
+		for len(queue) > 0 {
+			role := queue[0]
+			queue = queue[1:]
+			if held[role] {
+				continue
+			}
+			held[role] = true
+			roles = append(roles, models.Roles{Username: grant.Username, Role: role, InheritedFrom: grant.Role})
+			queue = append(queue, parents[role]...)
+		}
+	}
+	return roles
+}
+
+// inheritsFrom reports whether role reaches ancestor through parents
+func inheritsFrom(parents map[string][]string, role string, ancestor string) bool {
+	seen := make(map[string]bool)
+	queue := []string{role}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if current == ancestor {
+			return true
+		}
+		if seen[current] {
+			continue
+		}
+		seen[current] = true
+		queue = append(queue, parents[current]...)
+	}
+	return false
+}
+
+func GetRoleParents(role string) ([]models.RoleInheritance, error) {
+	var edges []models.RoleInheritance
+	result := models.DB.Order("parent").Find(&edges, "role = ?", role)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return edges, nil
+}
+
+// AddRoleParent makes role inherit from parent. Both have to be in the catalog,
+// and parent may not already inherit from role.
+func AddRoleParent(role string, parent string) error {
+	if _, err := GetRoleDefinition(role); err != nil {
+		return err
+	}
+	if _, err := GetRoleDefinition(parent); err != nil {
+		return err
+	}
+
+	parents, err := loadRoleInheritance()
+	if err != nil {
+		return err
+	}
+	if inheritsFrom(parents, parent, role) {
+		return ErrRoleInheritanceCycle
+	}
+
+	edgeEntry := &models.RoleInheritance{
+		Role:   role,
+		Parent: parent,
+	}
+
+	err = models.DB.Create(edgeEntry).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrRoleInheritanceExists
+	}
+	if err != nil {
+		return err
+	}
+
+	return roleHoldersChanged(role)
+}
+
+func RemoveRoleParent(role string, parent string) error {
+	result := models.DB.Unscoped().Where("role = ? AND parent = ?", role, parent).Delete(&models.RoleInheritance{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRoleInheritanceNotFound
+	}
+	return roleHoldersChanged(role)
+}
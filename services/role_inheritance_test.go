@@ -0,0 +1,130 @@
+package services
+
+import (
+	"auth-api-go/models"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var roleInheritanceColumns = []string{"id", "created_at", "updated_at", "deleted_at", "role", "parent"}
+
+// expectRoleInheritance expects the inheritance table to be read, returning
+// edges as role, parent pairs
+func expectRoleInheritance(mock sqlmock.Sqlmock, edges ...string) {
+	rows := sqlmock.NewRows(roleInheritanceColumns)
+	for i := 0; i+1 < len(edges); i += 2 {
+		rows.AddRow(i+1, nil, nil, nil, edges[i], edges[i+1])
+	}
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "role_inheritances"`)).
+		WillReturnRows(rows)
+}
+
+func TestResolveInheritedRoles(t *testing.T) {
+	direct := []models.Roles{
+		{Username: "testuser", Role: "admin"},
+		{Username: "testuser", Role: "viewer"},
+	}
+	parents := map[string][]string{
+		"admin":  {"editor"},
+		"editor": {"viewer", "commenter"},
+	}
+
+	roles := resolveInheritedRoles(direct, parents)
+
+	want := map[string]string{"admin": "", "viewer": "", "editor": "admin", "commenter": "admin"}
+	if len(roles) != len(want) {
+		t.Fatalf("resolveInheritedRoles() returned %d roles, want %d", len(roles), len(want))
+	}
+	for _, role := range roles {
+		inheritedFrom, ok := want[role.Role]
+		if !ok || role.InheritedFrom != inheritedFrom {
+			t.Errorf("resolveInheritedRoles() role %q inheritedFrom = %q, want %q", role.Role, role.InheritedFrom, inheritedFrom)
+		}
+	}
+}
+
+func TestRoleCheck_Inherited(t *testing.T) {
+	mock, cleanup := setupRoleMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "roles" WHERE (username = $1 AND (org = '' OR org = $2) AND (expires_at IS NULL OR expires_at > $3))`)).
+		WithArgs("testuser", "", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "deleted_at", "username", "role"}).
+			AddRow(1, nil, nil, nil, "testuser", "admin"))
+	expectGroupRoles(mock, "testuser")
+	expectRoleInheritance(mock, "admin", "editor", "editor", "viewer")
+
+	grant, err := GetRoleGrant("viewer", "testuser")
+	if err != nil {
+		t.Fatalf("GetRoleGrant() error = %v", err)
+	}
+	if grant == nil || grant.InheritedFrom != "admin" {
+		t.Errorf("GetRoleGrant() = %+v, want viewer inherited from admin", grant)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestAddRoleParent_Cycle(t *testing.T) {
+	mock, cleanup := setupRoleMockDB(t)
+	defer cleanup()
+
+	expectRoleDefinition(mock, "viewer", true)
+	expectRoleDefinition(mock, "admin", false)
+	expectRoleInheritance(mock, "admin", "editor", "editor", "viewer")
+
+	err := AddRoleParent("viewer", "admin")
+	if !errors.Is(err, ErrRoleInheritanceCycle) {
+		t.Errorf("AddRoleParent() error = %v, want %v", err, ErrRoleInheritanceCycle)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestAddRoleParent_Self(t *testing.T) {
+	mock, cleanup := setupRoleMockDB(t)
+	defer cleanup()
+
+	expectRoleDefinition(mock, "editor", false)
+	expectRoleDefinition(mock, "editor", false)
+	expectRoleInheritance(mock)
+
+	err := AddRoleParent("editor", "editor")
+	if !errors.Is(err, ErrRoleInheritanceCycle) {
+		t.Errorf("AddRoleParent() error = %v, want %v", err, ErrRoleInheritanceCycle)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestAddRoleParent_Success(t *testing.T) {
+	mock, cleanup := setupRoleMockDB(t)
+	defer cleanup()
+
+	expectRoleDefinition(mock, "admin", false)
+	expectRoleDefinition(mock, "editor", false)
+	expectRoleInheritance(mock, "editor", "viewer")
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "role_inheritances"`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "admin", "editor").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	err := AddRoleParent("admin", "editor")
+	if err != nil {
+		t.Errorf("AddRoleParent() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"auth-api-go/models"
+	"fmt"
+	"time"
+)
+
+// ReapExpiredRoles deletes role grants whose ExpiresAt has passed, records
+// each one in the audit trail and ends the sessions of tokens that still
+// embed them. Checks against the database already ignore lapsed grants.
+func ReapExpiredRoles() (int, error) {
+	var expired []models.Roles
+	result := models.DB.Find(&expired, "expires_at <= ?", time.Now())
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if len(expired) == 0 {
+		return 0, nil
+	}
+
+	result = models.DB.Delete(&expired)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	usernames := make([]string, 0, len(expired))
+	for _, role := range expired {
+		usernames = append(usernames, role.Username)
+		err := RecordAuditEvent(AuditRoleExpire, role.Username, role.GrantedBy, "", role.Role)
+		if err != nil {
+			fmt.Println("error recording audit event", err.Error())
+		}
+	}
+
+	return len(expired), rolesChanged(usernames...)
+}
+
+// StartRoleReaper runs ReapExpiredRoles every ROLE_REAPER_INTERVAL_SECONDS
+// in the background. Replicas may reap concurrently; deleting a row twice is
+// harmless.
+func StartRoleReaper() {
+	interval := time.Duration(envInt("ROLE_REAPER_INTERVAL_SECONDS", 60)) * time.Second
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			reaped, err := ReapExpiredRoles()
+			if err != nil {
+				fmt.Println("error reaping expired roles", err.Error())
+				continue
+			}
+			if reaped > 0 {
+				fmt.Printf("Reaped %d expired role grants\n", reaped)
+			}
+		}
+	}()
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var roleColumns = []string{"id", "created_at", "updated_at", "deleted_at", "username", "role", "expires_at", "granted_by"}
+
+func TestReapExpiredRoles(t *testing.T) {
+	mock, cleanup := setupRoleMockDB(t)
+	defer cleanup()
+
+	expiredAt := time.Now().Add(-time.Minute)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "roles" WHERE expires_at <= $1`)).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(roleColumns).
+			AddRow(7, nil, nil, nil, "testuser", "oncall", expiredAt, "admin-user"))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "roles" SET "deleted_at"=$1 WHERE "roles"."id" = $2`)).
+		WithArgs(sqlmock.AnyArg(), 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "audit_events"`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), AuditRoleExpire, "testuser", "admin-user", "", "oncall").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	reaped, err := ReapExpiredRoles()
+	if err != nil {
+		t.Errorf("ReapExpiredRoles() error = %v", err)
+	}
+	if reaped != 1 {
+		t.Errorf("ReapExpiredRoles() = %v, want 1", reaped)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestReapExpiredRoles_NoneExpired(t *testing.T) {
+	mock, cleanup := setupRoleMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "roles" WHERE expires_at <= $1`)).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(roleColumns))
+
+	reaped, err := ReapExpiredRoles()
+	if err != nil {
+		t.Errorf("ReapExpiredRoles() error = %v", err)
+	}
+	if reaped != 0 {
+		t.Errorf("ReapExpiredRoles() = %v, want 0", reaped)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestGrantRole_Temporary(t *testing.T) {
+	mock, cleanup := setupRoleMockDB(t)
+	defer cleanup()
+
+	expectRoleDefinition(mock, "oncall", false)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "roles"`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "testuser", "oncall", "", sqlmock.AnyArg(), "admin-user").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	err := GrantRole("testuser", "oncall", "admin-user", 8*time.Hour)
+	if err != nil {
+		t.Errorf("GrantRole() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
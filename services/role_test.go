@@ -2,6 +2,7 @@ package services
 
 import (
 	"auth-api-go/models"
+	"errors"
 	"regexp"
 	"testing"
 
@@ -45,9 +46,11 @@ func TestGetRolesByUsername_Success(t *testing.T) {
 		AddRow(1, nil, nil, nil, "testuser", "admin").
 		AddRow(2, nil, nil, nil, "testuser", "user")
 
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "roles" WHERE username = $1`)).
-		WithArgs("testuser").
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "roles" WHERE (username = $1 AND (org = '' OR org = $2) AND (expires_at IS NULL OR expires_at > $3))`)).
+		WithArgs("testuser", "", sqlmock.AnyArg()).
 		WillReturnRows(rows)
+	expectGroupRoles(mock, "testuser")
+	expectRoleInheritance(mock)
 
 	roles, err := GetRolesByUsername("testuser")
 	if err != nil {
@@ -79,9 +82,10 @@ func TestGetRolesByUsername_NoRoles(t *testing.T) {
 
 	rows := sqlmock.NewRows([]string{"id", "created_at", "updated_at", "deleted_at", "username", "role"})
 
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "roles" WHERE username = $1`)).
-		WithArgs("testuser").
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "roles" WHERE (username = $1 AND (org = '' OR org = $2) AND (expires_at IS NULL OR expires_at > $3))`)).
+		WithArgs("testuser", "", sqlmock.AnyArg()).
 		WillReturnRows(rows)
+	expectGroupRoles(mock, "testuser")
 
 	roles, err := GetRolesByUsername("testuser")
 	if err != nil {
@@ -102,8 +106,8 @@ func TestGetRolesByUsername_DBError(t *testing.T) {
 	mock, cleanup := setupRoleMockDB(t)
 	defer cleanup()
 
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "roles" WHERE username = $1`)).
-		WithArgs("testuser").
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "roles" WHERE (username = $1 AND (org = '' OR org = $2) AND (expires_at IS NULL OR expires_at > $3))`)).
+		WithArgs("testuser", "", sqlmock.AnyArg()).
 		WillReturnError(gorm.ErrInvalidDB)
 
 	roles, err := GetRolesByUsername("testuser")
@@ -124,9 +128,11 @@ func TestRoleCheck_HasRole(t *testing.T) {
 		AddRow(1, nil, nil, nil, "testuser", "admin").
 		AddRow(2, nil, nil, nil, "testuser", "user")
 
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "roles" WHERE username = $1`)).
-		WithArgs("testuser").
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "roles" WHERE (username = $1 AND (org = '' OR org = $2) AND (expires_at IS NULL OR expires_at > $3))`)).
+		WithArgs("testuser", "", sqlmock.AnyArg()).
 		WillReturnRows(rows)
+	expectGroupRoles(mock, "testuser")
+	expectRoleInheritance(mock)
 
 	hasRole, err := RoleCheck("admin", "testuser")
 	if err != nil {
@@ -150,9 +156,11 @@ func TestRoleCheck_DoesNotHaveRole(t *testing.T) {
 	rows := sqlmock.NewRows([]string{"id", "created_at", "updated_at", "deleted_at", "username", "role"}).
 		AddRow(1, nil, nil, nil, "testuser", "user")
 
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "roles" WHERE username = $1`)).
-		WithArgs("testuser").
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "roles" WHERE (username = $1 AND (org = '' OR org = $2) AND (expires_at IS NULL OR expires_at > $3))`)).
+		WithArgs("testuser", "", sqlmock.AnyArg()).
 		WillReturnRows(rows)
+	expectGroupRoles(mock, "testuser")
+	expectRoleInheritance(mock)
 
 	hasRole, err := RoleCheck("admin", "testuser")
 	if err != nil {
@@ -175,9 +183,10 @@ func TestRoleCheck_NoRoles(t *testing.T) {
 
 	rows := sqlmock.NewRows([]string{"id", "created_at", "updated_at", "deleted_at", "username", "role"})
 
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "roles" WHERE username = $1`)).
-		WithArgs("testuser").
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "roles" WHERE (username = $1 AND (org = '' OR org = $2) AND (expires_at IS NULL OR expires_at > $3))`)).
+		WithArgs("testuser", "", sqlmock.AnyArg()).
 		WillReturnRows(rows)
+	expectGroupRoles(mock, "testuser")
 
 	hasRole, err := RoleCheck("admin", "testuser")
 	if err != nil {
@@ -198,8 +207,8 @@ func TestRoleCheck_DBError(t *testing.T) {
 	mock, cleanup := setupRoleMockDB(t)
 	defer cleanup()
 
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "roles" WHERE username = $1`)).
-		WithArgs("testuser").
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "roles" WHERE (username = $1 AND (org = '' OR org = $2) AND (expires_at IS NULL OR expires_at > $3))`)).
+		WithArgs("testuser", "", sqlmock.AnyArg()).
 		WillReturnError(gorm.ErrInvalidDB)
 
 	hasRole, err := RoleCheck("admin", "testuser")
@@ -240,9 +249,10 @@ func TestAddRole_DBError(t *testing.T) {
 	mock, cleanup := setupRoleMockDB(t)
 	defer cleanup()
 
+	expectRoleDefinition(mock, "admin", false)
 	mock.ExpectBegin()
 	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "roles"`)).
-		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "testuser", "admin").
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "testuser", "admin", "", nil, "").
 		WillReturnError(gorm.ErrInvalidDB)
 	mock.ExpectRollback()
 
@@ -275,3 +285,147 @@ func TestAddRole_DBError(t *testing.T) {
 //		t.Errorf("Unfulfilled expectations: %v", err)
 //	}
 //}
+
+func TestIsRoleSelfAssignable(t *testing.T) {
+	mock, cleanup := setupRoleMockDB(t)
+	defer cleanup()
+
+	expectRoleDefinition(mock, "billing", false)
+	expectRoleDefinition(mock, "viewer", true)
+	expectRoleInheritance(mock)
+
+	tests := []struct {
+		role string
+		want bool
+	}{
+		{"admin", false},
+		{"billing", false},
+		{"viewer", true},
+	}
+
+	for _, tt := range tests {
+		got, err := IsRoleSelfAssignable(tt.role)
+		if err != nil {
+			t.Errorf("IsRoleSelfAssignable(%q) error = %v", tt.role, err)
+		}
+		if got != tt.want {
+			t.Errorf("IsRoleSelfAssignable(%q) = %v, want %v", tt.role, got, tt.want)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// An assignable role that inherits admin or a non-assignable role would let
+// users grant themselves those through it
+func TestIsRoleSelfAssignable_Inherited(t *testing.T) {
+	tests := []struct {
+		name   string
+		parent string
+	}{
+		{"inherits admin", AdminRole},
+		{"inherits non-assignable role", "billing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, cleanup := setupRoleMockDB(t)
+			defer cleanup()
+
+			expectRoleDefinition(mock, "helper", true)
+			expectRoleInheritance(mock, "helper", "viewer", "viewer", tt.parent)
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "role_definitions" WHERE "role_definitions"."deleted_at" IS NULL ORDER BY name`)).
+				WillReturnRows(sqlmock.NewRows(roleDefinitionColumns).
+					AddRow(1, nil, nil, nil, AdminRole, "", "system", false).
+					AddRow(2, nil, nil, nil, "billing", "", "admin-user", false).
+					AddRow(3, nil, nil, nil, "helper", "", "admin-user", true).
+					AddRow(4, nil, nil, nil, "viewer", "", "admin-user", true))
+
+			got, err := IsRoleSelfAssignable("helper")
+			if err != nil {
+				t.Fatalf("IsRoleSelfAssignable() error = %v", err)
+			}
+			if got {
+				t.Errorf("IsRoleSelfAssignable() = true, want false when it inherits %s", tt.parent)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestAssignOwnRole_Protected(t *testing.T) {
+	mock, cleanup := setupRoleMockDB(t)
+	defer cleanup()
+
+	err := AssignOwnRole("testuser", "", AdminRole, 0)
+	if !errors.Is(err, ErrRoleNotSelfAssignable) {
+		t.Errorf("AssignOwnRole() error = %v, want %v", err, ErrRoleNotSelfAssignable)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestRemoveRole_Success(t *testing.T) {
+	mock, cleanup := setupRoleMockDB(t)
+	defer cleanup()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "roles" SET "deleted_at"=$1 WHERE (username = $2 AND role = $3 AND org = $4)`)).
+		WithArgs(sqlmock.AnyArg(), "testuser", "editor", "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err := RemoveRole("testuser", "editor")
+	if err != nil {
+		t.Errorf("RemoveRole() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestRemoveOwnRole_Success(t *testing.T) {
+	mock, cleanup := setupRoleMockDB(t)
+	defer cleanup()
+
+	expectRoleDefinition(mock, "viewer", true)
+	expectRoleInheritance(mock)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "roles" SET "deleted_at"=$1 WHERE (username = $2 AND role = $3 AND org = $4)`)).
+		WithArgs(sqlmock.AnyArg(), "testuser", "viewer", "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err := RemoveOwnRole("testuser", "", "viewer")
+	if err != nil {
+		t.Errorf("RemoveOwnRole() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestRemoveOwnRole_NotAssignable(t *testing.T) {
+	mock, cleanup := setupRoleMockDB(t)
+	defer cleanup()
+
+	expectRoleDefinition(mock, "billing", false)
+
+	err := RemoveOwnRole("testuser", "", "billing")
+	if !errors.Is(err, ErrRoleNotSelfAssignable) {
+		t.Errorf("RemoveOwnRole() error = %v, want %v", err, ErrRoleNotSelfAssignable)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
@@ -4,8 +4,17 @@ import (
 	"auth-api-go/redis"
 	"context"
 	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt"
 )
 
+// Session describes a user's active session token
+type Session struct {
+	Org       string    `json:"org,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
 func DeleteSessionInRedis(username string) (bool, error) {
 	ctx := context.Background()
 	err := redis.REDIS.Del(ctx, username+"-token").Err()
@@ -15,3 +24,26 @@ func DeleteSessionInRedis(username string) (bool, error) {
 	}
 	return true, nil
 }
+
+// GetSessions lists username's active sessions. A user has at most one.
+func GetSessions(username string) ([]Session, error) {
+	ctx := context.Background()
+	val, err := redis.REDIS.Get(ctx, username+"-token").Result()
+	if err != nil {
+		if err.Error() == "redis: nil" {
+			return []Session{}, nil
+		}
+		fmt.Println("error with redis get", err.Error())
+		return nil, fmt.Errorf("error with redis get: %v", err)
+	}
+
+	// Only tokens this service signed are stored, so the claims can be read
+	// without checking the signature again
+	claims := &Claims{}
+	_, _, err = new(jwt.Parser).ParseUnverified(val, claims)
+	if err != nil {
+		return []Session{}, nil
+	}
+
+	return []Session{{Org: claims.Org, ExpiresAt: time.Unix(claims.ExpiresAt, 0)}}, nil
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"auth-api-go/models"
+	"auth-api-go/redis"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// tokenEmbedConfig reads TOKEN_EMBED, a comma separated list of "roles"
+// and/or "permissions" to put in session tokens, and TOKEN_EMBED_MAX_BYTES,
+// the most JSON those claims may take up.
+func tokenEmbedConfig() (embedRoles bool, embedPermissions bool, maxBytes int) {
+	for _, claim := range strings.Split(os.Getenv("TOKEN_EMBED"), ",") {
+		switch strings.TrimSpace(claim) {
+		case "roles":
+			embedRoles = true
+		case "permissions":
+			embedPermissions = true
+		}
+	}
+	return embedRoles, embedPermissions, envInt("TOKEN_EMBED_MAX_BYTES", 2048)
+}
+
+// embedAuthzClaims adds the effective roles and/or permissions to claims.
+// When they would make the token too big, neither is embedded and
+// AuthzOmitted is set instead.
+func embedAuthzClaims(claims *Claims) error {
+	embedRoles, embedPermissions, maxBytes := tokenEmbedConfig()
+	if !embedRoles && !embedPermissions {
+		return nil
+	}
+
+	roles, err := GetOrgRolesByUsername(claims.Username, claims.Org)
+	if err != nil {
+		return err
+	}
+
+	var roleNames, permissions []string
+	if embedRoles {
+		for _, role := range roles {
+			roleNames = append(roleNames, role.Role)
+		}
+	}
+	if embedPermissions {
+		permissions, err = getPermissionsForRoles(roles)
+		if err != nil {
+			return err
+		}
+	}
+
+	embedded, err := json.Marshal(struct {
+		Roles       []string `json:"roles,omitempty"`
+		Permissions []string `json:"permissions,omitempty"`
+	}{roleNames, permissions})
+	if err != nil {
+		return err
+	}
+	if len(embedded) > maxBytes {
+		claims.AuthzOmitted = true
+		return nil
+	}
+
+	claims.Roles = roleNames
+	claims.Permissions = permissions
+	return nil
+}
+
+// rolesChanged ends the sessions of usernames when tokens embed roles or
+// permissions, so no token keeps claims that are no longer true. Without
+// embedding every check reads the database and there is nothing to do.
+func rolesChanged(usernames ...string) error {
+	embedRoles, embedPermissions, _ := tokenEmbedConfig()
+	if (!embedRoles && !embedPermissions) || len(usernames) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(usernames))
+	for _, username := range usernames {
+		keys = append(keys, username+"-token")
+	}
+
+	ctx := context.Background()
+	err := redis.REDIS.Del(ctx, keys...).Err()
+	if err != nil {
+		fmt.Println("error with redis del", err.Error())
+		return fmt.Errorf("error with redis del: %v", err)
+	}
+	return nil
+}
+
+// roleHoldersChanged calls rolesChanged for everyone holding role, directly,
+// through a role that inherits it or through a group, after the role's
+// permissions or parents change.
+func roleHoldersChanged(role string) error {
+	embedRoles, embedPermissions, _ := tokenEmbedConfig()
+	if !embedRoles && !embedPermissions {
+		return nil
+	}
+
+	parents, err := loadRoleInheritance()
+	if err != nil {
+		return err
+	}
+
+	affected := []string{}
+	for candidate := range parents {
+		if inheritsFrom(parents, candidate, role) {
+			affected = append(affected, candidate)
+		}
+	}
+	affected = append(affected, role)
+
+	var usernames []string
+	result := models.DB.Model(&models.Roles{}).Distinct().Where("role IN ?", affected).Pluck("username", &usernames)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	var members []string
+	result = models.DB.Model(&models.GroupMember{}).Distinct().
+		Joins("JOIN group_roles ON group_roles.group_name = group_members.group_name AND group_roles.deleted_at IS NULL").
+		Where("group_roles.role IN ?", affected).
+		Pluck("group_members.username", &members)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	return rolesChanged(append(usernames, members...)...)
+}
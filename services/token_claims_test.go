@@ -0,0 +1,109 @@
+package services
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func expectEmbeddedRoles(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "roles" WHERE (username = $1 AND (org = '' OR org = $2) AND (expires_at IS NULL OR expires_at > $3))`)).
+		WithArgs("testuser", "", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "deleted_at", "username", "role"}).
+			AddRow(1, nil, nil, nil, "testuser", "editor"))
+	expectGroupRoles(mock, "testuser")
+	expectRoleInheritance(mock, "editor", "viewer")
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "role_permissions" WHERE role IN ($1,$2)`)).
+		WithArgs("editor", "viewer").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "deleted_at", "role", "permission"}).
+			AddRow(1, nil, nil, nil, "editor", "documents:write").
+			AddRow(2, nil, nil, nil, "viewer", "documents:read"))
+}
+
+func TestEmbedAuthzClaims_Disabled(t *testing.T) {
+	mock, cleanup := setupRoleMockDB(t)
+	defer cleanup()
+
+	claims := &Claims{Username: "testuser"}
+	if err := embedAuthzClaims(claims); err != nil {
+		t.Errorf("embedAuthzClaims() error = %v", err)
+	}
+	if claims.Roles != nil || claims.Permissions != nil {
+		t.Errorf("embedAuthzClaims() embedded %v %v without TOKEN_EMBED", claims.Roles, claims.Permissions)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestEmbedAuthzClaims(t *testing.T) {
+	t.Setenv("TOKEN_EMBED", "roles, permissions")
+
+	mock, cleanup := setupRoleMockDB(t)
+	defer cleanup()
+	expectEmbeddedRoles(mock)
+
+	claims := &Claims{Username: "testuser"}
+	if err := embedAuthzClaims(claims); err != nil {
+		t.Fatalf("embedAuthzClaims() error = %v", err)
+	}
+
+	if want := []string{"editor", "viewer"}; !reflect.DeepEqual(claims.Roles, want) {
+		t.Errorf("embedAuthzClaims() roles = %v, want %v", claims.Roles, want)
+	}
+	if want := []string{"documents:read", "documents:write"}; !reflect.DeepEqual(claims.Permissions, want) {
+		t.Errorf("embedAuthzClaims() permissions = %v, want %v", claims.Permissions, want)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestEmbedAuthzClaims_TooBig(t *testing.T) {
+	t.Setenv("TOKEN_EMBED", "roles,permissions")
+	t.Setenv("TOKEN_EMBED_MAX_BYTES", "16")
+
+	mock, cleanup := setupRoleMockDB(t)
+	defer cleanup()
+	expectEmbeddedRoles(mock)
+
+	claims := &Claims{Username: "testuser"}
+	if err := embedAuthzClaims(claims); err != nil {
+		t.Fatalf("embedAuthzClaims() error = %v", err)
+	}
+
+	if !claims.AuthzOmitted || claims.Roles != nil || claims.Permissions != nil {
+		t.Errorf("embedAuthzClaims() = %+v, want claims omitted", claims)
+	}
+}
+
+func TestRolesChanged(t *testing.T) {
+	t.Setenv("TOKEN_EMBED", "roles")
+	mock := setupMockRedis(t)
+
+	mock.ExpectDel("alice-token", "bob-token").SetVal(2)
+
+	if err := rolesChanged("alice", "bob"); err != nil {
+		t.Errorf("rolesChanged() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestRolesChanged_Disabled(t *testing.T) {
+	mock := setupMockRedis(t)
+
+	if err := rolesChanged("alice"); err != nil {
+		t.Errorf("rolesChanged() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
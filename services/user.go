@@ -2,25 +2,65 @@ package services
 
 import (
 	"auth-api-go/models"
+	"auth-api-go/redis"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrIncorrectPassword = errors.New("password is incorrect")
+	ErrUsernameTaken     = errors.New("username is taken")
 )
 
 func CreateUser(username string, password string) (*models.User, error) {
-	hash, err := HashPassword(password)
+	userEntry, err := newUserEntry(context.Background(), username, password, "")
 	if err != nil {
 		return nil, err
 	}
 
-	userEntry := &models.User{
-		Username: username,
-		Hash:     hash,
+	err = insertUser(models.DB, userEntry)
+	if err != nil {
+		return nil, err
 	}
 
-	err = models.DB.Create(userEntry).Error
+	return userEntry, nil
+}
+
+// newUserEntry validates and hashes password for a user that isn't saved yet.
+// Hashing is slow, so it is done before any transaction is opened.
+// newUserEntry hashes password under ctx, so a client that has gone away
+// doesn't keep a hashing worker busy.
+func newUserEntry(ctx context.Context, username string, password string, email string) (*models.User, error) {
+	err := ValidatePassword(username, password)
 	if err != nil {
 		return nil, err
 	}
 
-	return userEntry, nil
+	hash, err := HashPasswordContext(ctx, password)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &models.User{
+		Username:          username,
+		Hash:              hash,
+		PasswordChangedAt: &now,
+		Email:             email,
+	}, nil
+}
+
+// insertUser saves userEntry using db, which may be a transaction.
+func insertUser(db *gorm.DB, userEntry *models.User) error {
+	err := db.Create(userEntry).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrUsernameTaken
+	}
+	return err
 }
 
 func GetUserByUsername(username string) (*models.User, error) {
@@ -31,13 +71,54 @@ func GetUserByUsername(username string) (*models.User, error) {
 	return &user, nil
 }
 
+// userRows are the rows keyed by a bare username, by the column holding it.
+// They are soft-deleted, restored and purged along with the account.
+var userRows = []struct {
+	column string
+	model  func() interface{}
+}{
+	{"username", func() interface{} { return &models.Roles{} }},
+	{"username", func() interface{} { return &models.GroupMember{} }},
+	{"username", func() interface{} { return &models.OrgMember{} }},
+	{"username", func() interface{} { return &models.PasswordHistory{} }},
+	{"subject", func() interface{} { return &models.RelationTuple{} }},
+}
+
+// DeleteUserByUsername soft-deletes username along with their roles, group
+// and org memberships, relation tuples and password history, and clears
+// their status marker. Everything gets the same deleted_at, so RestoreUser
+// can bring back exactly the rows that went with the account.
 func DeleteUserByUsername(username string) error {
-	var user models.User
-	result := models.DB.Where("username = ?", username).Delete(&user)
-	if result.Error != nil {
-		return result.Error
+	// Postgres keeps microseconds; matching precision lets restores compare
+	deletedAt := time.Now().Truncate(time.Microsecond)
+
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.User{}).Where("username = ?", username).UpdateColumn("deleted_at", deletedAt).Error
+		if err != nil {
+			return err
+		}
+
+		for _, row := range userRows {
+			err := tx.Model(row.model()).Where(row.column+" = ?", username).UpdateColumn("deleted_at", deletedAt).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Someone registering the name next starts without the old status
+	ctx := context.Background()
+	err = redis.REDIS.Del(ctx, username+"-status").Err()
+	if err != nil {
+		fmt.Println("error with redis del", err.Error())
+		return fmt.Errorf("error with redis del: %v", err)
 	}
-	return nil
+
+	return bumpRelationRevision()
 }
 
 func AuthenticateUser(username string, password string) (bool, error) {
@@ -47,3 +128,53 @@ func AuthenticateUser(username string, password string) (bool, error) {
 	}
 	return CheckPasswordHash(password, user.Hash), nil
 }
+
+// ChangePassword replaces the user's password after checking the current one,
+// validating the new one against the password policy and making sure it
+// wasn't used recently. Each of those hashes stops once ctx is cancelled.
+func ChangePassword(ctx context.Context, username string, currentPassword string, newPassword string) error {
+	user, err := GetUserByUsername(username)
+	if err != nil {
+		return err
+	}
+
+	isMatch, err := CheckPasswordHashContext(ctx, currentPassword, user.Hash)
+	if err != nil {
+		return err
+	}
+	if !isMatch {
+		return ErrIncorrectPassword
+	}
+
+	err = ValidatePassword(username, newPassword)
+	if err != nil {
+		return err
+	}
+
+	err = checkPasswordReuse(ctx, user, newPassword)
+	if err != nil {
+		return err
+	}
+
+	hash, err := HashPasswordContext(ctx, newPassword)
+	if err != nil {
+		return err
+	}
+
+	return savePassword(user, hash)
+}
+
+// RehashPasswordIfNeeded re-hashes a just-verified password when its stored
+// hash uses an old pepper version, so rotating the pepper happens lazily.
+func RehashPasswordIfNeeded(ctx context.Context, user *models.User, password string) error {
+	if !NeedsRehash(user.Hash) {
+		return nil
+	}
+
+	hash, err := HashPasswordContext(ctx, password)
+	if err != nil {
+		return err
+	}
+
+	return models.DB.Model(user).Update("hash", hash).Error
+}
@@ -0,0 +1,267 @@
+package services
+
+import (
+	"auth-api-go/models"
+	"auth-api-go/redis"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Page sizes for ListUsers
+const (
+	DefaultUserPageSize = 50
+	MaxUserPageSize     = 200
+)
+
+var ErrUserNotFound = errors.New("user not found")
+
+// UserFilter narrows ListUsers. Nil and zero fields don't filter.
+type UserFilter struct {
+	// Query matches part of the username or email, ignoring case
+	Query         string
+	Role          string
+	Status        string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Locked        *bool
+	// Deleted lists deleted accounts instead of live ones
+	Deleted bool
+	// Cursor is the ID of the last user on the previous page
+	Cursor uint
+	Limit  int
+}
+
+// UserSummary is what admins see of an account; the password hash is left out
+type UserSummary struct {
+	ID                uint       `json:"id"`
+	Username          string     `json:"username"`
+	Email             string     `json:"email"`
+	CreatedAt         time.Time  `json:"createdAt"`
+	DeletedAt         *time.Time `json:"deletedAt,omitempty"`
+	PasswordChangedAt *time.Time `json:"passwordChangedAt"`
+	LastLoginAt       *time.Time `json:"lastLoginAt"`
+	LastLoginIP       string     `json:"lastLoginIp,omitempty"`
+	Status            string     `json:"status"`
+	StatusReason      string     `json:"statusReason,omitempty"`
+	StatusChangedAt   *time.Time `json:"statusChangedAt,omitempty"`
+	// Locked is a lockout after failed logins, apart from Status
+	Locked bool `json:"locked"`
+}
+
+// UserDetail adds a user's roles and sessions to their summary
+type UserDetail struct {
+	UserSummary
+	Roles    []models.Roles `json:"roles"`
+	Sessions []Session      `json:"sessions"`
+}
+
+func newUserSummary(user models.User) UserSummary {
+	summary := UserSummary{
+		ID:                user.ID,
+		Username:          user.Username,
+		Email:             user.Email,
+		CreatedAt:         user.CreatedAt,
+		PasswordChangedAt: user.PasswordChangedAt,
+		LastLoginAt:       user.LastLoginAt,
+		LastLoginIP:       user.LastLoginIP,
+		Status:            user.Status,
+		StatusReason:      user.StatusReason,
+		StatusChangedAt:   user.StatusChangedAt,
+	}
+	if user.DeletedAt.Valid {
+		summary.DeletedAt = &user.DeletedAt.Time
+	}
+	return summary
+}
+
+// ListUsers returns a page of users matching filter in ID order, and the
+// cursor for the next page, which is empty on the last one. The role filter
+// only matches roles granted to the user directly and deployment-wide, so it
+// doesn't pick up the same role granted in an org.
+func ListUsers(filter UserFilter) ([]UserSummary, string, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultUserPageSize
+	}
+	if filter.Limit > MaxUserPageSize {
+		filter.Limit = MaxUserPageSize
+	}
+
+	query := models.DB.Model(&models.User{})
+	if filter.Deleted {
+		query = query.Unscoped().Where("deleted_at IS NOT NULL")
+	}
+	if filter.Cursor > 0 {
+		query = query.Where("id > ?", filter.Cursor)
+	}
+	if filter.Query != "" {
+		pattern := "%" + escapeLike(strings.ToLower(filter.Query)) + "%"
+		query = query.Where("LOWER(username) LIKE ? OR LOWER(email) LIKE ?", pattern, pattern)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.CreatedAfter != nil {
+		query = query.Where("created_at >= ?", *filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != nil {
+		query = query.Where("created_at < ?", *filter.CreatedBefore)
+	}
+	if filter.Role != "" {
+		query = query.Where("username IN (?)", models.DB.Model(&models.Roles{}).Select("username").
+			Where("role = ? AND org = '' AND (expires_at IS NULL OR expires_at > ?)", filter.Role, time.Now()))
+	}
+	if filter.Locked != nil {
+		locked, err := lockedUsernames()
+		if err != nil {
+			return nil, "", err
+		}
+		if *filter.Locked {
+			if len(locked) == 0 {
+				return []UserSummary{}, "", nil
+			}
+			query = query.Where("username IN ?", locked)
+		} else if len(locked) > 0 {
+			query = query.Where("username NOT IN ?", locked)
+		}
+	}
+
+	// One extra row tells whether there is another page
+	var users []models.User
+	err := query.Order("id").Limit(filter.Limit + 1).Find(&users).Error
+	if err != nil {
+		return nil, "", err
+	}
+
+	var nextCursor string
+	if len(users) > filter.Limit {
+		users = users[:filter.Limit]
+		nextCursor = strconv.FormatUint(uint64(users[len(users)-1].ID), 10)
+	}
+
+	summaries := make([]UserSummary, 0, len(users))
+	usernames := make([]string, 0, len(users))
+	for _, user := range users {
+		summaries = append(summaries, newUserSummary(user))
+		usernames = append(usernames, user.Username)
+	}
+
+	locked, err := areUsersLocked(usernames)
+	if err != nil {
+		return nil, "", err
+	}
+	for i := range summaries {
+		summaries[i].Locked = locked[i]
+	}
+
+	return summaries, nextCursor, nil
+}
+
+// GetUserDetail returns username's account, deleted or not, with the roles
+// they hold outside any org and their active sessions.
+func GetUserDetail(username string) (*UserDetail, error) {
+	var user models.User
+	// The live account first, otherwise the most recently deleted one
+	err := models.DB.Unscoped().Where("username = ?", username).Order("deleted_at desc").First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	detail := &UserDetail{UserSummary: newUserSummary(user)}
+
+	locked, err := areUsersLocked([]string{username})
+	if err != nil {
+		return nil, err
+	}
+	detail.Locked = locked[0]
+
+	detail.Roles, err = GetRolesByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+
+	detail.Sessions, err = GetSessions(username)
+	if err != nil {
+		return nil, err
+	}
+
+	return detail, nil
+}
+
+// RecordLastLogin notes when and from where username last logged in
+func RecordLastLogin(username string, ip string) error {
+	now := time.Now()
+	return models.DB.Model(&models.User{}).Where("username = ?", username).
+		Updates(models.User{LastLoginAt: &now, LastLoginIP: ip}).Error
+}
+
+// areUsersLocked reports whether each of usernames is locked out of logging in
+func areUsersLocked(usernames []string) ([]bool, error) {
+	locked := make([]bool, len(usernames))
+	if len(usernames) == 0 {
+		return locked, nil
+	}
+
+	keys := make([]string, 0, len(usernames))
+	for _, username := range usernames {
+		keys = append(keys, userThrottleKey(username)+"-lock")
+	}
+
+	ctx := context.Background()
+	values, err := redis.REDIS.MGet(ctx, keys...).Result()
+	if err != nil {
+		fmt.Println("error with redis mget", err.Error())
+		return nil, fmt.Errorf("error with redis mget: %v", err)
+	}
+
+	for i, value := range values {
+		locked[i] = isLockActive(value)
+	}
+	return locked, nil
+}
+
+// lockedUsernames returns every username currently locked out. Lockouts that
+// have ended are dropped from lockedUsersKey first.
+func lockedUsernames() ([]string, error) {
+	ctx := context.Background()
+
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	err := redis.REDIS.ZRemRangeByScore(ctx, lockedUsersKey, "-inf", now).Err()
+	if err != nil {
+		fmt.Println("error with redis zremrangebyscore", err.Error())
+		return nil, fmt.Errorf("error with redis zremrangebyscore: %v", err)
+	}
+
+	usernames, err := redis.REDIS.ZRange(ctx, lockedUsersKey, 0, -1).Result()
+	if err != nil {
+		fmt.Println("error with redis zrange", err.Error())
+		return nil, fmt.Errorf("error with redis zrange: %v", err)
+	}
+	return usernames, nil
+}
+
+// isLockActive reads a lock value, the unix millisecond it ends at
+func isLockActive(value interface{}) bool {
+	text, ok := value.(string)
+	if !ok {
+		return false
+	}
+	until, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return false
+	}
+	return time.Now().Before(time.UnixMilli(until))
+}
+
+// escapeLike stops LIKE wildcards in a search term from matching anything
+func escapeLike(term string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(term)
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang-jwt/jwt"
+)
+
+var userColumns = []string{"id", "created_at", "updated_at", "deleted_at", "username", "hash", "email", "last_login_at"}
+
+func TestListUsers_SearchAndPaginate(t *testing.T) {
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+	redisMock := setupMockRedis(t)
+
+	rows := sqlmock.NewRows(userColumns).
+		AddRow(6, time.Now(), time.Now(), nil, "testuser", "hash", "test@example.com", nil).
+		AddRow(8, time.Now(), time.Now(), nil, "tester", "hash", "tester@example.com", time.Now()).
+		AddRow(9, time.Now(), time.Now(), nil, "testing", "hash", "testing@example.com", nil)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE id > $1 AND (LOWER(username) LIKE $2 OR LOWER(email) LIKE $3) AND "users"."deleted_at" IS NULL ORDER BY id LIMIT $4`)).
+		WithArgs(5, "%test\\_%", "%test\\_%", 3).
+		WillReturnRows(rows)
+	lockedUntil := strconv.FormatInt(time.Now().Add(time.Minute).UnixMilli(), 10)
+	redisMock.ExpectMGet("login:user:testuser-lock", "login:user:tester-lock").SetVal([]interface{}{nil, lockedUntil})
+
+	users, nextCursor, err := ListUsers(UserFilter{Query: "Test_", Cursor: 5, Limit: 2})
+	if err != nil {
+		t.Fatalf("ListUsers() error = %v", err)
+	}
+
+	if len(users) != 2 || users[0].Username != "testuser" || users[1].Username != "tester" {
+		t.Fatalf("ListUsers() = %v, want testuser and tester", users)
+	}
+	if users[0].Locked || !users[1].Locked {
+		t.Errorf("ListUsers() locked = %v, %v, want false, true", users[0].Locked, users[1].Locked)
+	}
+	if nextCursor != "8" {
+		t.Errorf("ListUsers() nextCursor = %q, want 8", nextCursor)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+	if err := redisMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled redis expectations: %v", err)
+	}
+}
+
+func TestListUsers_Role(t *testing.T) {
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+	redisMock := setupMockRedis(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE username IN (SELECT "username" FROM "roles" WHERE (role = $1 AND org = '' AND (expires_at IS NULL OR expires_at > $2)) AND "roles"."deleted_at" IS NULL) AND "users"."deleted_at" IS NULL ORDER BY id LIMIT $3`)).
+		WithArgs("admin", sqlmock.AnyArg(), DefaultUserPageSize+1).
+		WillReturnRows(sqlmock.NewRows(userColumns).
+			AddRow(1, time.Now(), time.Now(), nil, "root", "hash", "root@example.com", nil))
+	redisMock.ExpectMGet("login:user:root-lock").SetVal([]interface{}{nil})
+
+	users, _, err := ListUsers(UserFilter{Role: "admin"})
+	if err != nil {
+		t.Fatalf("ListUsers() error = %v", err)
+	}
+	if len(users) != 1 || users[0].Username != "root" {
+		t.Errorf("ListUsers() = %v, want root", users)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+	if err := redisMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled redis expectations: %v", err)
+	}
+}
+
+func TestListUsers_LockedNone(t *testing.T) {
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+	redisMock := setupMockRedis(t)
+
+	redisMock.Regexp().ExpectZRemRangeByScore("login:locked-users", `^-inf$`, `^\d+$`).SetVal(0)
+	redisMock.ExpectZRange("login:locked-users", 0, -1).SetVal([]string{})
+
+	locked := true
+	users, nextCursor, err := ListUsers(UserFilter{Locked: &locked})
+	if err != nil {
+		t.Fatalf("ListUsers() error = %v", err)
+	}
+
+	if len(users) != 0 || nextCursor != "" {
+		t.Errorf("ListUsers() = %v, %q, want no users", users, nextCursor)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+	if err := redisMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled redis expectations: %v", err)
+	}
+}
+
+func TestGetUserDetail_NotFound(t *testing.T) {
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE username = $1 ORDER BY deleted_at desc,"users"."id" LIMIT $2`)).
+		WithArgs("nobody", 1).
+		WillReturnRows(sqlmock.NewRows(userColumns))
+
+	_, err := GetUserDetail("nobody")
+	if !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("GetUserDetail() error = %v, want %v", err, ErrUserNotFound)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestGetSessions(t *testing.T) {
+	redisMock := setupMockRedis(t)
+
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{
+		Username:       "testuser",
+		Org:            "acme",
+		StandardClaims: jwt.StandardClaims{ExpiresAt: expiresAt.Unix()},
+	}).SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatalf("SignedString() error = %v", err)
+	}
+
+	redisMock.ExpectGet("testuser-token").SetVal(token)
+	redisMock.ExpectGet("other-token").RedisNil()
+
+	sessions, err := GetSessions("testuser")
+	if err != nil {
+		t.Fatalf("GetSessions() error = %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].Org != "acme" || !sessions[0].ExpiresAt.Equal(expiresAt) {
+		t.Errorf("GetSessions() = %v, want one acme session", sessions)
+	}
+
+	sessions, err = GetSessions("other")
+	if err != nil {
+		t.Fatalf("GetSessions() error = %v", err)
+	}
+	if len(sessions) != 0 {
+		t.Errorf("GetSessions() = %v, want none", sessions)
+	}
+
+	if err := redisMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled redis expectations: %v", err)
+	}
+}
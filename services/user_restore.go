@@ -0,0 +1,198 @@
+package services
+
+import (
+	"auth-api-go/models"
+	"auth-api-go/redis"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRestoreExpired  = errors.New("the restore grace period has ended")
+	ErrRestoreConflict = errors.New("a row deleted with the user has been recreated since")
+)
+
+const (
+	// userPurgeBatchSize is how many users PurgeDeletedUsers removes per
+	// transaction
+	userPurgeBatchSize = 500
+	// userPurgeLockKey keeps replicas from purging at the same time, and
+	// expires on its own if the holder dies mid-run
+	userPurgeLockKey = "user-purge:lock"
+	userPurgeLockTTL = 10 * time.Minute
+)
+
+// userRestoreGrace reads USER_RESTORE_GRACE_DAYS, how long deleted users can
+// be restored before they are purged
+func userRestoreGrace() time.Duration {
+	return time.Duration(envInt("USER_RESTORE_GRACE_DAYS", 30)) * 24 * time.Hour
+}
+
+// RestoreUser brings back the most recently deleted account named username,
+// with the roles, memberships, relation tuples and password history deleted
+// along with it. It fails with ErrUsernameTaken once someone else has
+// registered the name, and with ErrRestoreConflict when one of those rows has
+// been recreated, e.g. the name was added back to a group through another
+// account since purged.
+func RestoreUser(username string) (*models.User, error) {
+	var user models.User
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Where("username = ? AND deleted_at IS NOT NULL", username).
+			Order("deleted_at desc").First(&user).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		deletedAt := user.DeletedAt.Time
+		if time.Since(deletedAt) > userRestoreGrace() {
+			return ErrRestoreExpired
+		}
+
+		// The unique index only covers live users, so this is where a
+		// re-registered username shows up
+		err = tx.Unscoped().Model(&user).UpdateColumn("deleted_at", nil).Error
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return ErrUsernameTaken
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, row := range userRows {
+			err := tx.Unscoped().Model(row.model()).Where(row.column+" = ? AND deleted_at = ?", username, deletedAt).
+				UpdateColumn("deleted_at", nil).Error
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return ErrRestoreConflict
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Deleting cleared the status marker ParseToken checks
+	if user.Status != "" && user.Status != UserActive {
+		ctx := context.Background()
+		err := redis.REDIS.Set(ctx, username+"-status", user.Status, 0).Err()
+		if err != nil {
+			fmt.Println("error with redis set", err.Error())
+			return nil, fmt.Errorf("error with redis set: %v", err)
+		}
+	}
+
+	if err := bumpRelationRevision(); err != nil {
+		return nil, err
+	}
+
+	user.DeletedAt = gorm.DeletedAt{}
+	return &user, nil
+}
+
+// PurgeDeletedUsers hard-deletes users deleted longer than
+// USER_RESTORE_GRACE_DAYS ago, and the rows deleted with them before then,
+// recording each purged user in the audit trail. It works in batches of
+// userPurgeBatchSize and returns without purging while another replica holds
+// the purge lock.
+func PurgeDeletedUsers() (int, error) {
+	ctx := context.Background()
+	locked, err := redis.REDIS.SetNX(ctx, userPurgeLockKey, 1, userPurgeLockTTL).Result()
+	if err != nil {
+		fmt.Println("error with redis setnx", err.Error())
+		return 0, fmt.Errorf("error with redis setnx: %v", err)
+	}
+	if !locked {
+		return 0, nil
+	}
+	defer func() {
+		if err := redis.REDIS.Del(ctx, userPurgeLockKey).Err(); err != nil {
+			fmt.Println("error with redis del", err.Error())
+		}
+	}()
+
+	cutoff := time.Now().Add(-userRestoreGrace())
+	total := 0
+	for {
+		purged, err := purgeDeletedUserBatch(cutoff)
+		total += purged
+		if err != nil {
+			return total, err
+		}
+		if purged < userPurgeBatchSize {
+			return total, nil
+		}
+	}
+}
+
+// purgeDeletedUserBatch purges up to userPurgeBatchSize users deleted before
+// cutoff, returning how many it purged.
+func purgeDeletedUserBatch(cutoff time.Time) (int, error) {
+	var expired []models.User
+	result := models.DB.Unscoped().Order("id").Limit(userPurgeBatchSize).Find(&expired, "deleted_at < ?", cutoff)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if len(expired) == 0 {
+		return 0, nil
+	}
+
+	usernames := make([]string, 0, len(expired))
+	for _, user := range expired {
+		usernames = append(usernames, user.Username)
+	}
+
+	// Live rows of anyone who has since registered the same name are kept
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		for _, row := range userRows {
+			err := tx.Unscoped().Where(row.column+" IN ? AND deleted_at < ?", usernames, cutoff).Delete(row.model()).Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Unscoped().Delete(&expired).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, user := range expired {
+		err := RecordAuditEvent(AuditUserPurge, user.Username, "", "", "")
+		if err != nil {
+			fmt.Println("error recording audit event", err.Error())
+		}
+	}
+
+	return len(expired), nil
+}
+
+// StartUserPurger runs PurgeDeletedUsers every USER_PURGE_INTERVAL_MINUTES in
+// the background. Each run happens on one replica at a time.
+func StartUserPurger() {
+	interval := time.Duration(envInt("USER_PURGE_INTERVAL_MINUTES", 60)) * time.Minute
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			purged, err := PurgeDeletedUsers()
+			if err != nil {
+				fmt.Println("error purging deleted users", err.Error())
+				continue
+			}
+			if purged > 0 {
+				fmt.Printf("Purged %d deleted users\n", purged)
+			}
+		}
+	}()
+}
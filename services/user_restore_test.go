@@ -0,0 +1,188 @@
+package services
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func expectDeletedUser(mock sqlmock.Sqlmock, deletedAt time.Time) {
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE username = $1 AND deleted_at IS NOT NULL ORDER BY deleted_at desc,"users"."id" LIMIT $2`)).
+		WithArgs("testuser", 1).
+		WillReturnRows(sqlmock.NewRows(userColumns).
+			AddRow(4, time.Now(), time.Now(), deletedAt, "testuser", "hash", "test@example.com", nil))
+}
+
+func TestRestoreUser(t *testing.T) {
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+	redisMock := setupMockRedis(t)
+
+	deletedAt := time.Now().Add(-24 * time.Hour)
+	mock.ExpectBegin()
+	expectDeletedUser(mock, deletedAt)
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "users" SET "deleted_at"=$1 WHERE "id" = $2`)).
+		WithArgs(nil, 4).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	for _, table := range []string{"roles", "group_members", "org_members", "password_histories"} {
+		mock.ExpectExec(regexp.QuoteMeta(`UPDATE "`+table+`" SET "deleted_at"=$1 WHERE username = $2 AND deleted_at = $3`)).
+			WithArgs(nil, "testuser", deletedAt).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "relation_tuples" SET "deleted_at"=$1 WHERE subject = $2 AND deleted_at = $3`)).
+		WithArgs(nil, "testuser", deletedAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	redisMock.ExpectIncr("relation-revision").SetVal(2)
+
+	user, err := RestoreUser("testuser")
+	if err != nil {
+		t.Fatalf("RestoreUser() error = %v", err)
+	}
+	if user.DeletedAt.Valid {
+		t.Error("RestoreUser() should return a live user")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+	if err := redisMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled redis expectations: %v", err)
+	}
+}
+
+func TestRestoreUser_GracePeriodOver(t *testing.T) {
+	t.Setenv("USER_RESTORE_GRACE_DAYS", "7")
+
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	mock.ExpectBegin()
+	expectDeletedUser(mock, time.Now().Add(-8*24*time.Hour))
+	mock.ExpectRollback()
+
+	if _, err := RestoreUser("testuser"); !errors.Is(err, ErrRestoreExpired) {
+		t.Errorf("RestoreUser() error = %v, want %v", err, ErrRestoreExpired)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestRestoreUser_UsernameReused(t *testing.T) {
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	mock.ExpectBegin()
+	expectDeletedUser(mock, time.Now().Add(-time.Hour))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "users" SET "deleted_at"=$1 WHERE "id" = $2`)).
+		WithArgs(nil, 4).
+		WillReturnError(&pgconn.PgError{Code: "23505"})
+	mock.ExpectRollback()
+
+	if _, err := RestoreUser("testuser"); !errors.Is(err, ErrUsernameTaken) {
+		t.Errorf("RestoreUser() error = %v, want %v", err, ErrUsernameTaken)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestRestoreUser_RowRecreated(t *testing.T) {
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	deletedAt := time.Now().Add(-time.Hour)
+	mock.ExpectBegin()
+	expectDeletedUser(mock, deletedAt)
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "users" SET "deleted_at"=$1 WHERE "id" = $2`)).
+		WithArgs(nil, 4).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "roles" SET "deleted_at"=$1 WHERE username = $2 AND deleted_at = $3`)).
+		WithArgs(nil, "testuser", deletedAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "group_members" SET "deleted_at"=$1 WHERE username = $2 AND deleted_at = $3`)).
+		WithArgs(nil, "testuser", deletedAt).
+		WillReturnError(&pgconn.PgError{Code: "23505"})
+	mock.ExpectRollback()
+
+	if _, err := RestoreUser("testuser"); !errors.Is(err, ErrRestoreConflict) {
+		t.Errorf("RestoreUser() error = %v, want %v", err, ErrRestoreConflict)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPurgeDeletedUsers(t *testing.T) {
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+	redisMock := setupMockRedis(t)
+
+	redisMock.ExpectSetNX(userPurgeLockKey, 1, userPurgeLockTTL).SetVal(true)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE deleted_at < $1 ORDER BY id LIMIT $2`)).
+		WithArgs(sqlmock.AnyArg(), userPurgeBatchSize).
+		WillReturnRows(sqlmock.NewRows(userColumns).
+			AddRow(4, time.Now(), time.Now(), time.Now().Add(-60*24*time.Hour), "testuser", "hash", "", nil))
+	mock.ExpectBegin()
+	for _, table := range []string{"roles", "group_members", "org_members", "password_histories"} {
+		mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "`+table+`" WHERE username IN ($1) AND deleted_at < $2`)).
+			WithArgs("testuser", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "relation_tuples" WHERE subject IN ($1) AND deleted_at < $2`)).
+		WithArgs("testuser", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "users" WHERE "users"."id" = $1`)).
+		WithArgs(4).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "audit_events"`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), AuditUserPurge, "testuser", "", "", "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+	redisMock.ExpectDel(userPurgeLockKey).SetVal(1)
+
+	purged, err := PurgeDeletedUsers()
+	if err != nil {
+		t.Errorf("PurgeDeletedUsers() error = %v", err)
+	}
+	if purged != 1 {
+		t.Errorf("PurgeDeletedUsers() = %v, want 1", purged)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+	if err := redisMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled redis expectations: %v", err)
+	}
+}
+
+func TestPurgeDeletedUsers_Locked(t *testing.T) {
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+	redisMock := setupMockRedis(t)
+
+	redisMock.ExpectSetNX(userPurgeLockKey, 1, userPurgeLockTTL).SetVal(false)
+
+	purged, err := PurgeDeletedUsers()
+	if err != nil || purged != 0 {
+		t.Errorf("PurgeDeletedUsers() = %v, %v, want 0 while another replica purges", purged, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+	if err := redisMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled redis expectations: %v", err)
+	}
+}
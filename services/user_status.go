@@ -0,0 +1,91 @@
+package services
+
+import (
+	"auth-api-go/models"
+	"auth-api-go/redis"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Account statuses. Only active users can log in or use their session.
+const (
+	UserActive              = "active"
+	UserSuspended           = "suspended"
+	UserLocked              = "locked"
+	UserPendingVerification = "pending-verification"
+)
+
+var (
+	ErrUserStatusInvalid = errors.New("status must be active, suspended, locked or pending-verification")
+	ErrUserNotActive     = errors.New("account is not active")
+)
+
+// IsUserActive treats accounts saved before statuses existed as active
+func IsUserActive(user *models.User) bool {
+	return user.Status == "" || user.Status == UserActive
+}
+
+// SuspendUser cuts username off with status, suspended when empty, and ends
+// their session straight away. Their data is kept.
+func SuspendUser(username string, status string, reason string, actor string) error {
+	if status == "" {
+		status = UserSuspended
+	}
+	if status == UserActive {
+		return ErrUserStatusInvalid
+	}
+	return setUserStatus(username, status, reason, actor)
+}
+
+// ReinstateUser makes username active again
+func ReinstateUser(username string, actor string) error {
+	return setUserStatus(username, UserActive, "", actor)
+}
+
+func setUserStatus(username string, status string, reason string, actor string) error {
+	switch status {
+	case UserActive, UserSuspended, UserLocked, UserPendingVerification:
+	default:
+		return ErrUserStatusInvalid
+	}
+
+	// A map so reinstating clears the reason
+	result := models.DB.Model(&models.User{}).Where("username = ?", username).Updates(map[string]interface{}{
+		"status":            status,
+		"status_reason":     reason,
+		"status_changed_at": time.Now(),
+		"status_changed_by": actor,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	ctx := context.Background()
+	if status == UserActive {
+		err := redis.REDIS.Del(ctx, username+"-status").Err()
+		if err != nil {
+			fmt.Println("error with redis del", err.Error())
+			return fmt.Errorf("error with redis del: %v", err)
+		}
+		return nil
+	}
+
+	// ParseToken checks this marker, so a session opened while the status
+	// was being changed is refused too
+	err := redis.REDIS.Set(ctx, username+"-status", status, 0).Err()
+	if err != nil {
+		fmt.Println("error with redis set", err.Error())
+		return fmt.Errorf("error with redis set: %v", err)
+	}
+
+	_, err = DeleteSessionInRedis(username)
+	if err != nil {
+		return err
+	}
+	return DeletePasswordChangeToken(username)
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang-jwt/jwt"
+)
+
+func TestSuspendUser(t *testing.T) {
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+	redisMock := setupMockRedis(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "users" SET "status"=$1,"status_changed_at"=$2,"status_changed_by"=$3,"status_reason"=$4,"updated_at"=$5 WHERE username = $6`)).
+		WithArgs(UserSuspended, sqlmock.AnyArg(), "admin", "chargeback", sqlmock.AnyArg(), "testuser").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	redisMock.ExpectSet("testuser-status", UserSuspended, 0).SetVal("OK")
+	redisMock.ExpectDel("testuser-token").SetVal(1)
+	redisMock.ExpectDel("testuser-password-change").SetVal(0)
+
+	if err := SuspendUser("testuser", "", "chargeback", "admin"); err != nil {
+		t.Errorf("SuspendUser() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+	if err := redisMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled redis expectations: %v", err)
+	}
+}
+
+func TestSuspendUser_InvalidStatus(t *testing.T) {
+	for _, status := range []string{UserActive, "banned"} {
+		if err := SuspendUser("testuser", status, "", "admin"); !errors.Is(err, ErrUserStatusInvalid) {
+			t.Errorf("SuspendUser(%q) error = %v, want %v", status, err, ErrUserStatusInvalid)
+		}
+	}
+}
+
+func TestReinstateUser_NotFound(t *testing.T) {
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "users" SET`)).
+		WithArgs(UserActive, sqlmock.AnyArg(), "admin", "", sqlmock.AnyArg(), "nobody").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	if err := ReinstateUser("nobody", "admin"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("ReinstateUser() error = %v, want %v", err, ErrUserNotFound)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestParseToken_SuspendedUser(t *testing.T) {
+	redisMock := setupMockRedis(t)
+
+	jwtKey := []byte("secret")
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{
+		Username:       "testuser",
+		StandardClaims: jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Hour).Unix()},
+	}).SignedString(jwtKey)
+	if err != nil {
+		t.Fatalf("SignedString() error = %v", err)
+	}
+
+	redisMock.ExpectGet("testuser-token").SetVal(token)
+	redisMock.ExpectGet("testuser-status").SetVal(UserSuspended)
+
+	_, err = ParseToken(token, jwtKey)
+	if !errors.Is(err, ErrUserNotActive) {
+		t.Errorf("ParseToken() error = %v, want %v", err, ErrUserNotActive)
+	}
+
+	if err := redisMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled redis expectations: %v", err)
+	}
+}
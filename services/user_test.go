@@ -2,10 +2,13 @@ package services
 
 import (
 	"auth-api-go/models"
+	"context"
+	"errors"
 	"regexp"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -21,7 +24,7 @@ func setupMockDB(t *testing.T) (sqlmock.Sqlmock, func()) {
 		DriverName: "postgres",
 	})
 
-	gormDB, err := gorm.Open(dialector, &gorm.Config{})
+	gormDB, err := gorm.Open(dialector, &gorm.Config{TranslateError: true})
 	if err != nil {
 		t.Fatalf("Failed to open GORM DB: %v", err)
 	}
@@ -43,7 +46,7 @@ func TestCreateUser_Success(t *testing.T) {
 
 	mock.ExpectBegin()
 	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "users"`)).
-		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "testuser", sqlmock.AnyArg()).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "testuser", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), nil, "", UserActive, "", nil, "").
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 	mock.ExpectCommit()
 
@@ -81,7 +84,7 @@ func TestCreateUser_DBError(t *testing.T) {
 
 	mock.ExpectBegin()
 	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "users"`)).
-		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "testuser", sqlmock.AnyArg()).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "testuser", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), nil, "", UserActive, "", nil, "").
 		WillReturnError(gorm.ErrInvalidDB)
 	mock.ExpectRollback()
 
@@ -95,6 +98,26 @@ func TestCreateUser_DBError(t *testing.T) {
 	}
 }
 
+func TestCreateUser_UsernameTaken(t *testing.T) {
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "users"`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "testuser", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), nil, "", UserActive, "", nil, "").
+		WillReturnError(&pgconn.PgError{Code: "23505"})
+	mock.ExpectRollback()
+
+	user, err := CreateUser("testuser", "password123")
+	if !errors.Is(err, ErrUsernameTaken) {
+		t.Errorf("CreateUser() error = %v, want %v", err, ErrUsernameTaken)
+	}
+
+	if user != nil {
+		t.Error("CreateUser() should return nil user when the username is taken")
+	}
+}
+
 func TestGetUserByUsername_Success(t *testing.T) {
 	mock, cleanup := setupMockDB(t)
 	defer cleanup()
@@ -147,12 +170,23 @@ func TestGetUserByUsername_NotFound(t *testing.T) {
 func TestDeleteUserByUsername_Success(t *testing.T) {
 	mock, cleanup := setupMockDB(t)
 	defer cleanup()
+	redisMock := setupMockRedis(t)
 
 	mock.ExpectBegin()
 	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "users" SET "deleted_at"=$1 WHERE username = $2`)).
 		WithArgs(sqlmock.AnyArg(), "testuser").
 		WillReturnResult(sqlmock.NewResult(0, 1))
+	for _, table := range []string{"roles", "group_members", "org_members", "password_histories"} {
+		mock.ExpectExec(regexp.QuoteMeta(`UPDATE "`+table+`" SET "deleted_at"=$1 WHERE username = $2 AND "`+table+`"."deleted_at" IS NULL`)).
+			WithArgs(sqlmock.AnyArg(), "testuser").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "relation_tuples" SET "deleted_at"=$1 WHERE subject = $2 AND "relation_tuples"."deleted_at" IS NULL`)).
+		WithArgs(sqlmock.AnyArg(), "testuser").
+		WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectCommit()
+	redisMock.ExpectDel("testuser-status").SetVal(1)
+	redisMock.ExpectIncr("relation-revision").SetVal(2)
 
 	err := DeleteUserByUsername("testuser")
 	if err != nil {
@@ -162,6 +196,9 @@ func TestDeleteUserByUsername_Success(t *testing.T) {
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("Unfulfilled expectations: %v", err)
 	}
+	if err := redisMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled redis expectations: %v", err)
+	}
 }
 
 func TestDeleteUserByUsername_DBError(t *testing.T) {
@@ -254,3 +291,117 @@ func TestAuthenticateUser_UserNotFound(t *testing.T) {
 		t.Error("AuthenticateUser() should return false for non-existent user")
 	}
 }
+
+func TestCreateUser_PolicyViolation(t *testing.T) {
+	_, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	user, err := CreateUser("testuser", "")
+	var policyErr *PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		t.Errorf("CreateUser() error = %v, want *PasswordPolicyError", err)
+	}
+
+	if user != nil {
+		t.Error("CreateUser() should return nil user on policy violation")
+	}
+}
+
+func TestChangePassword_Success(t *testing.T) {
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	hashedPassword, _ := HashPassword("password123")
+
+	rows := sqlmock.NewRows([]string{"id", "created_at", "updated_at", "deleted_at", "username", "hash"}).
+		AddRow(1, nil, nil, nil, "testuser", hashedPassword)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE username = $1 AND "users"."deleted_at" IS NULL ORDER BY "users"."id" LIMIT $2`)).
+		WithArgs("testuser", 1).
+		WillReturnRows(rows)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "password_histories" WHERE username = $1`)).
+		WithArgs("testuser", 5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "hash"}))
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "password_histories"`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "testuser", hashedPassword).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "password_histories" WHERE username = $1 AND id NOT IN`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "users" SET "hash"=$1,"password_changed_at"=$2,"updated_at"=$3`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err := ChangePassword(context.Background(), "testuser", "password123", "newPassword456")
+	if err != nil {
+		t.Errorf("ChangePassword() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestChangePassword_WrongPassword(t *testing.T) {
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	hashedPassword, _ := HashPassword("password123")
+
+	rows := sqlmock.NewRows([]string{"id", "created_at", "updated_at", "deleted_at", "username", "hash"}).
+		AddRow(1, nil, nil, nil, "testuser", hashedPassword)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE username = $1 AND "users"."deleted_at" IS NULL ORDER BY "users"."id" LIMIT $2`)).
+		WithArgs("testuser", 1).
+		WillReturnRows(rows)
+
+	err := ChangePassword(context.Background(), "testuser", "wrongpassword", "newPassword456")
+	if !errors.Is(err, ErrIncorrectPassword) {
+		t.Errorf("ChangePassword() error = %v, want %v", err, ErrIncorrectPassword)
+	}
+}
+
+// A client that has gone away shouldn't keep hashing workers busy
+func TestChangePassword_Cancelled(t *testing.T) {
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE username = $1 AND "users"."deleted_at" IS NULL ORDER BY "users"."id" LIMIT $2`)).
+		WithArgs("testuser", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "hash"}).AddRow(1, "testuser", "hash"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := ChangePassword(ctx, "testuser", "password123", "newPassword456")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("ChangePassword() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestChangePassword_Reused(t *testing.T) {
+	mock, cleanup := setupMockDB(t)
+	defer cleanup()
+
+	hashedPassword, _ := HashPassword("password123")
+	previousHash, _ := HashPassword("oldPassword456")
+
+	rows := sqlmock.NewRows([]string{"id", "created_at", "updated_at", "deleted_at", "username", "hash"}).
+		AddRow(1, nil, nil, nil, "testuser", hashedPassword)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE username = $1 AND "users"."deleted_at" IS NULL ORDER BY "users"."id" LIMIT $2`)).
+		WithArgs("testuser", 1).
+		WillReturnRows(rows)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "password_histories" WHERE username = $1`)).
+		WithArgs("testuser", 5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "hash"}).AddRow(1, "testuser", previousHash))
+
+	err := ChangePassword(context.Background(), "testuser", "password123", "oldPassword456")
+	if !errors.Is(err, ErrPasswordReused) {
+		t.Errorf("ChangePassword() error = %v, want %v", err, ErrPasswordReused)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}